@@ -0,0 +1,276 @@
+// Package auth provides authentication middleware for bearer tokens, api keys, and http basic,
+// attaching the caller's identity to the request context.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/respond"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Bearer identifies a caller by static bearer token.
+	Bearer string = "bearer"
+	// ApiKey identifies a caller by api key.
+	ApiKey string = "api_key"
+	// Basic identifies a caller by http basic credentials.
+	Basic string = "basic"
+)
+
+var (
+	errMissing   = errors.New("missing credentials")
+	errInvalid   = errors.New("invalid credentials")
+	errForbidden = errors.New("forbidden")
+)
+
+// Config is the auth configuration.
+type Config struct {
+	TokenFile string `json:"token_file" desc:"file of name:token lines for bearer auth"`
+	KeyFile   string `json:"key_file" desc:"file of name:key lines for api key auth"`
+	KeyHeader string `json:"key_header" desc:"header bearing an api key" default:"X-Api-Key"`
+	KeyQuery  string `json:"key_query" desc:"query parameter bearing an api key, not accepted when blank"`
+	BasicFile string `json:"basic_file" desc:"file of user:bcrypt-hash lines, as from htpasswd -B, for basic auth"`
+	Realm     string `json:"realm" desc:"realm for basic auth" default:"delish"`
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+}
+
+// Auth authenticates requests by bearer token, api key, or http basic, as configured.
+//
+// Tokens and keys are compared in constant time, all of them, whatever the outcome.
+// Basic passwords are checked against bcrypt hashes, with unknown users taking as long as known.
+type Auth struct {
+	KeyHeader string
+	KeyQuery  string
+	Realm     string
+	Logger    logger.Logger
+	tokens    []secret
+	keys      []secret
+	users     map[string][]byte
+	dummy     []byte
+}
+
+// New creates Auth from Config, loading credentials from files.
+func (cfg *Config) New(lgr logger.Logger) (ath *Auth, err error) {
+
+	ath = &Auth{
+		KeyHeader: cfg.KeyHeader,
+		KeyQuery:  cfg.KeyQuery,
+		Realm:     cfg.Realm,
+		Logger:    lgr,
+	}
+
+	if ath.KeyHeader == "" {
+		ath.KeyHeader = "X-Api-Key"
+	}
+	if ath.Realm == "" {
+		ath.Realm = "delish"
+	}
+
+	ath.tokens, err = loadSecrets(cfg.TokenFile)
+	if err != nil {
+		return
+	}
+
+	ath.keys, err = loadSecrets(cfg.KeyFile)
+	if err != nil {
+		return
+	}
+
+	ath.users, err = loadUsers(cfg.BasicFile)
+	if err != nil {
+		return
+	}
+
+	if len(ath.users) > 0 {
+		ath.dummy, err = dummyHash(ath.users)
+	}
+
+	return
+}
+
+// With adds identity to ctx.
+func With(ctx context.Context, id *Identity) context.Context {
+
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext gets the identity stored in ctx by Wrap, nil when not found.
+func FromContext(ctx context.Context) *Identity {
+
+	id, _ := ctx.Value(ctxKey{}).(*Identity)
+	return id
+}
+
+// Wrap is a middleware authenticating requests, responding 401 to those that fail.
+//
+// The identity is added to ctx, along with a "user" logging field for basic or "client" otherwise.
+// As the request is passed on with a new ctx, a route pattern set by http.ServeMux within is not seen
+// by middleware without, see Guard.
+func (ath *Auth) Wrap(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		ctx := request.Context()
+
+		id, err := ath.authenticate(request)
+		if err != nil {
+			ath.challenge(writer.Header())
+			respond.New(writer, ath.Logger).NotOk(ctx, http.StatusUnauthorized, err)
+			return
+		}
+
+		ctx = With(ctx, id)
+		ctx = ath.Logger.WithFields(ctx, id.field(), id.Name)
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	}
+}
+
+// Require is a middleware responding 403 unless the identity in ctx is one of names.
+//
+// Wrap beforehand, else 401 is the response.
+func (ath *Auth) Require(next http.Handler, names ...string) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		ctx := request.Context()
+
+		id := FromContext(ctx)
+		if id == nil {
+			ath.challenge(writer.Header())
+			respond.New(writer, ath.Logger).NotOk(ctx, http.StatusUnauthorized, errMissing)
+			return
+		}
+
+		for _, name := range names {
+			if id.Name == name {
+				next.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		err := errors.Wrapf(errForbidden, "not allowed: %s", id.Name)
+		respond.New(writer, ath.Logger).NotOk(ctx, http.StatusForbidden, err)
+	}
+}
+
+// Router specifies a router interface à la stdlib http.ServeMux.
+type Router interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Guard gets a Router registering handlers with rtr behind Wrap, and Require when names are given.
+//
+// Handlers are guarded beneath the router, so the route pattern is seen by middleware without,
+// and routes such as boiler's can be guarded as they are registered.
+func (ath *Auth) Guard(rtr Router, names ...string) Router {
+
+	return &guarded{
+		rtr:   rtr,
+		ath:   ath,
+		names: names,
+	}
+}
+
+// unexported
+
+type ctxKey struct{}
+
+type guarded struct {
+	rtr   Router
+	ath   *Auth
+	names []string
+}
+
+func (grd *guarded) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+
+	var next http.Handler = http.HandlerFunc(handler)
+	if len(grd.names) > 0 {
+		next = grd.ath.Require(next, grd.names...)
+	}
+
+	grd.rtr.HandleFunc(pattern, grd.ath.Wrap(next))
+}
+
+func (id *Identity) field() string {
+
+	if id.Method == Basic {
+		return "user"
+	}
+	return "client"
+}
+
+// authenticate tries the authorization header, then the api key header, then the api key query parameter.
+func (ath *Auth) authenticate(request *http.Request) (id *Identity, err error) {
+
+	authz := request.Header.Get("Authorization")
+	if authz != "" {
+		scheme, credentials, _ := strings.Cut(authz, " ")
+
+		switch {
+		case strings.EqualFold(scheme, "Bearer") && len(ath.tokens) > 0:
+			return identify(ath.tokens, strings.TrimSpace(credentials), Bearer)
+		case strings.EqualFold(scheme, "Basic") && len(ath.users) > 0:
+			return ath.basic(request)
+		}
+
+		err = errors.Wrapf(errInvalid, "unsupported authorization scheme: %s", scheme)
+		return
+	}
+
+	if len(ath.keys) > 0 {
+		key := request.Header.Get(ath.KeyHeader)
+		if key == "" && ath.KeyQuery != "" && request.URL != nil {
+			key = request.URL.Query().Get(ath.KeyQuery)
+		}
+		if key != "" {
+			return identify(ath.keys, key, ApiKey)
+		}
+	}
+
+	err = errMissing
+	return
+}
+
+func (ath *Auth) basic(request *http.Request) (id *Identity, err error) {
+
+	user, password, ok := request.BasicAuth()
+	if !ok {
+		err = errors.Wrapf(errInvalid, "malformed basic credentials")
+		return
+	}
+
+	hash, found := ath.users[user]
+	if !found {
+		hash = ath.dummy
+	}
+
+	err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil || !found {
+		err = errInvalid
+		return
+	}
+
+	id = &Identity{Name: user, Method: Basic}
+	return
+}
+
+func (ath *Auth) challenge(header http.Header) {
+
+	if len(ath.tokens) > 0 {
+		header.Add("WWW-Authenticate", `Bearer realm="`+ath.Realm+`"`)
+	}
+	if len(ath.users) > 0 {
+		header.Add("WWW-Authenticate", `Basic realm="`+ath.Realm+`", charset="UTF-8"`)
+	}
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:generate moq -pkg auth -out mock_test.go ../logger Logger
+
+func TestAuth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Auth Suite")
+}
+
+var _ = Describe("Auth", func() {
+	var (
+		lgr      *LoggerMock
+		cfg      *Config
+		ath      *Auth
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		seen     *Identity
+		err      error
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("open-sesame"), bcrypt.MinCost)
+		Expect(err).ToNot(HaveOccurred())
+
+		cfg = &Config{
+			TokenFile: writeFile("tokens", "# deploy bots\nbuilder:tok-abc\n\nreporter:tok-xyz\n"),
+			KeyFile:   writeFile("keys", "partner:key-123\n"),
+			KeyQuery:  "api_key",
+			BasicFile: writeFile("users", "alice:"+string(hash)+"\n"),
+		}
+
+		request = httptest.NewRequest("GET", "/items", nil)
+		seen = nil
+	})
+
+	JustBeforeEach(func() {
+		ath, err = cfg.New(lgr)
+		Expect(err).ToNot(HaveOccurred())
+
+		handler := ath.Wrap(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			seen = FromContext(request.Context())
+		}))
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+	})
+
+	DescribeTable("authenticating",
+		func(setup func(request *http.Request), name, method, field string) {
+			setup(request)
+
+			ath, err := cfg.New(lgr)
+			Expect(err).ToNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			ath.Wrap(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				seen = FromContext(request.Context())
+			})).ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(seen).To(Equal(&Identity{Name: name, Method: method}))
+
+			wfc := lgr.WithFieldsCalls()
+			Expect(wfc[len(wfc)-1].Kv).To(Equal([]any{field, name}))
+		},
+		Entry("bearer token", func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer tok-xyz")
+		}, "reporter", Bearer, "client"),
+		Entry("bearer in any case", func(request *http.Request) {
+			request.Header.Set("Authorization", "bearer tok-abc")
+		}, "builder", Bearer, "client"),
+		Entry("api key header", func(request *http.Request) {
+			request.Header.Set("X-Api-Key", "key-123")
+		}, "partner", ApiKey, "client"),
+		Entry("api key query", func(request *http.Request) {
+			request.URL.RawQuery = "api_key=key-123"
+		}, "partner", ApiKey, "client"),
+		Entry("basic", func(request *http.Request) {
+			request.SetBasicAuth("alice", "open-sesame")
+		}, "alice", Basic, "user"),
+	)
+
+	When("no credentials are given", func() {
+		It("responds 401 with json and a challenge", func() {
+			Expect(seen).To(BeNil())
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(recorder.Header().Values("WWW-Authenticate")).To(Equal([]string{
+				`Bearer realm="delish"`,
+				`Basic realm="delish", charset="UTF-8"`,
+			}))
+			Expect(body(recorder)).To(Equal(map[string]any{"error": "missing credentials"}))
+		})
+	})
+
+	DescribeTable("rejecting",
+		func(setup func(request *http.Request), expected string) {
+			setup(request)
+
+			ath, err := cfg.New(lgr)
+			Expect(err).ToNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			ath.Wrap(http.NotFoundHandler()).ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(body(recorder)).To(Equal(map[string]any{"error": expected}))
+		},
+		Entry("wrong token", func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer tok-nope")
+		}, "invalid credentials"),
+		Entry("key as token", func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer key-123")
+		}, "invalid credentials"),
+		Entry("wrong key", func(request *http.Request) {
+			request.Header.Set("X-Api-Key", "key-nope")
+		}, "invalid credentials"),
+		Entry("wrong password", func(request *http.Request) {
+			request.SetBasicAuth("alice", "close-sesame")
+		}, "invalid credentials"),
+		Entry("unknown user", func(request *http.Request) {
+			request.SetBasicAuth("mallory", "open-sesame")
+		}, "invalid credentials"),
+		Entry("malformed basic", func(request *http.Request) {
+			request.Header.Set("Authorization", "Basic !!!")
+		}, "malformed basic credentials: invalid credentials"),
+		Entry("other scheme", func(request *http.Request) {
+			request.Header.Set("Authorization", "Digest username=alice")
+		}, "unsupported authorization scheme: Digest: invalid credentials"),
+	)
+
+	When("the api key query is not configured", func() {
+		BeforeEach(func() {
+			cfg.KeyQuery = ""
+			request.URL.RawQuery = "api_key=key-123"
+		})
+
+		It("is not accepted", func() {
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("requiring names", func() {
+		var (
+			handler http.Handler
+		)
+
+		JustBeforeEach(func() {
+			handler = ath.Wrap(ath.Require(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}), "builder"))
+		})
+
+		It("allows those named", func() {
+			request.Header.Set("Authorization", "Bearer tok-abc")
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+
+		It("forbids others", func() {
+			request.Header.Set("Authorization", "Bearer tok-xyz")
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(body(recorder)).To(Equal(map[string]any{"error": "not allowed: reporter: forbidden"}))
+		})
+
+		It("responds 401 when not wrapped", func() {
+			recorder = httptest.NewRecorder()
+			ath.Require(http.NotFoundHandler(), "builder").ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("guarding a router", func() {
+		It("guards routes as registered, leaving the pattern seen without", func() {
+			rtr := http.NewServeMux()
+			ath.Guard(rtr, "builder").HandleFunc("POST /log/{level}", func(writer http.ResponseWriter, request *http.Request) {})
+			rtr.HandleFunc("GET /monitor", func(writer http.ResponseWriter, request *http.Request) {})
+
+			serve := func(method, path, token string) (int, string) {
+				request := httptest.NewRequest(method, path, nil)
+				if token != "" {
+					request.Header.Set("Authorization", "Bearer "+token)
+				}
+				recorder := httptest.NewRecorder()
+				rtr.ServeHTTP(recorder, request)
+				return recorder.Code, request.Pattern
+			}
+
+			code, _ := serve("POST", "/log/debug", "")
+			Expect(code).To(Equal(http.StatusUnauthorized))
+
+			code, _ = serve("POST", "/log/debug", "tok-xyz")
+			Expect(code).To(Equal(http.StatusForbidden))
+
+			code, pattern := serve("POST", "/log/debug", "tok-abc")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(pattern).To(Equal("POST /log/{level}"))
+
+			code, _ = serve("GET", "/monitor", "")
+			Expect(code).To(Equal(http.StatusOK))
+		})
+	})
+
+	DescribeTable("rejecting bad files",
+		func(cfg *Config, expected string) {
+			_, err := cfg.New(lgr)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+			Expect(err.Error()).ToNot(ContainSubstring("sekrit"))
+		},
+		Entry("missing", &Config{TokenFile: "/does/not/exist"}, "failed to read credentials"),
+		Entry("malformed", &Config{KeyFile: writeFile("bad-keys", "ok:fine\nsekrit\n")}, "malformed line: 2"),
+		Entry("not bcrypt", &Config{BasicFile: writeFile("bad-users", "bob:sekrit\n")}, "not a bcrypt hash for user: bob"),
+	)
+})
+
+func writeFile(name, content string) string {
+
+	path := filepath.Join(os.TempDir(), "delish-auth-"+name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		panic(err)
+	}
+
+	return path
+}
+
+func body(recorder *httptest.ResponseRecorder) (obj map[string]any) {
+
+	err := json.Unmarshal(recorder.Body.Bytes(), &obj)
+	Expect(err).ToNot(HaveOccurred())
+
+	return
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HS256 is HMAC with SHA-256.
+	HS256 string = "HS256"
+	// RS256 is RSASSA-PKCS1-v1_5 with SHA-256.
+	RS256 string = "RS256"
+	// ES256 is ECDSA with P-256 and SHA-256.
+	ES256 string = "ES256"
+)
+
+// key is a verification key, its algorithm fixed by type so a token cannot choose another.
+type key struct {
+	id     string
+	alg    string
+	secret []byte
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+}
+
+// verify checks sig over signed.
+func (k *key) verify(signed, sig []byte) bool {
+
+	digest := sha256.Sum256(signed)
+
+	switch k.alg {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case RS256:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.ecdsa, digest[:], r, s)
+	}
+
+	return false
+}
+
+// jwk is a json web key, with only members used for verification.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJwks loads signing keys from a jwks file, skipping those for encryption.
+func loadJwks(path string) (keys []*key, err error) {
+
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read jwks")
+		return
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to decode jwks: %s", path)
+		return
+	}
+
+	for i, jk := range set.Keys {
+		if jk.Use != "" && jk.Use != "sig" {
+			continue
+		}
+
+		var k *key
+		k, err = jk.key()
+		if err != nil {
+			err = errors.Wrapf(err, "failed to load key: %d in: %s", i, path)
+			return
+		}
+		keys = append(keys, k)
+	}
+
+	return
+}
+
+func (jk jwk) key() (k *key, err error) {
+
+	k = &key{id: jk.Kid}
+
+	switch jk.Kty {
+	case "oct":
+		k.alg = HS256
+		k.secret, err = decodeSegment(jk.K)
+		if err == nil && len(k.secret) == 0 {
+			err = errors.Errorf("empty secret")
+		}
+	case "RSA":
+		k.alg = RS256
+		k.rsa, err = jk.rsaKey()
+	case "EC":
+		k.alg = ES256
+		k.ecdsa, err = jk.ecKey()
+	default:
+		err = errors.Errorf("unsupported key type: %s", jk.Kty)
+	}
+	if err != nil {
+		return
+	}
+
+	if jk.Alg != "" && jk.Alg != k.alg {
+		err = errors.Errorf("unsupported alg: %s for key type: %s", jk.Alg, jk.Kty)
+	}
+	return
+}
+
+func (jk jwk) rsaKey() (pub *rsa.PublicKey, err error) {
+
+	nb, err := decodeSegment(jk.N)
+	if err != nil {
+		return
+	}
+	eb, err := decodeSegment(jk.E)
+	if err != nil {
+		return
+	}
+
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		err = errors.Errorf("bad rsa exponent")
+		return
+	}
+
+	pub = &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}
+	return
+}
+
+func (jk jwk) ecKey() (pub *ecdsa.PublicKey, err error) {
+
+	if jk.Crv != "P-256" {
+		err = errors.Errorf("unsupported curve: %s", jk.Crv)
+		return
+	}
+
+	xb, err := decodeSegment(jk.X)
+	if err != nil {
+		return
+	}
+	yb, err := decodeSegment(jk.Y)
+	if err != nil {
+		return
+	}
+
+	if len(xb) != 32 || len(yb) != 32 {
+		err = errors.Errorf("bad coordinate length")
+		return
+	}
+
+	// checks the point is on the curve
+	_, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, xb...), yb...))
+	if err != nil {
+		err = errors.Wrapf(err, "bad ec point")
+		return
+	}
+
+	pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	return
+}
+
+// loadPem loads rsa and P-256 ecdsa public keys, and those of certificates, from a pem file.
+func loadPem(path string) (keys []*key, err error) {
+
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read pem")
+		return
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var pub any
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse %s in: %s", block.Type, path)
+			return
+		}
+
+		switch typed := pub.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, &key{alg: RS256, rsa: typed})
+		case *ecdsa.PublicKey:
+			if typed.Curve != elliptic.P256() {
+				err = errors.Errorf("unsupported curve: %s in: %s", typed.Curve.Params().Name, path)
+				return
+			}
+			keys = append(keys, &key{alg: ES256, ecdsa: typed})
+		default:
+			err = errors.Errorf("unsupported public key: %T in: %s", pub, path)
+			return
+		}
+	}
+
+	if len(keys) == 0 {
+		err = errors.Errorf("no public keys in: %s", path)
+	}
+	return
+}
+
+func decodeSegment(seg string) (data []byte, err error) {
+
+	data, err = base64.RawURLEncoding.DecodeString(seg)
+	err = errors.Wrapf(err, "failed to decode base64url")
+	return
+}
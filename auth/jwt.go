@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/respond"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Jwt identifies a caller by the subject of a verified jwt.
+	Jwt string = "jwt"
+
+	defaultSkew time.Duration = 30 * time.Second
+)
+
+var (
+	errToken   = errors.New("invalid token")
+	errScope   = errors.New("insufficient scope")
+	errPattern = errors.New("route scopes require a route pattern, wrap beneath the mux as with Guard")
+)
+
+// JwtConfig is the jwt verifier's configuration.
+type JwtConfig struct {
+	JwksFile    string              `json:"jwks_file" desc:"jwks file with verification keys"`
+	PemFile     string              `json:"pem_file" desc:"pem file with rsa or P-256 public keys or certificates"`
+	Issuer      string              `json:"issuer" desc:"required iss, not checked when blank"`
+	Audience    string              `json:"audience" desc:"required in aud, not checked when blank"`
+	Skew        time.Duration       `json:"skew" desc:"clock skew allowed when checking exp and nbf" default:"30s"`
+	Claims      []string            `json:"claims" desc:"claims added to ctx and logging fields" default:"sub"`
+	RouteScopes map[string][]string `json:"route_scopes" desc:"scopes required by route pattern, such as {\"POST /items\":[\"items:write\"]}"`
+}
+
+// Claims are those selected from a verified jwt.
+type Claims map[string]any
+
+// Verifier verifies jwts signed with HS256, RS256, or ES256, from the Authorization header as bearer.
+//
+// A key's algorithm is fixed by its type, so a token cannot pick another, nor "none".
+// Tokens with a kid are verified with keys of their alg having that kid, or none, as from pem.
+// Tokens must have exp, and are checked against nbf, iss, and aud, allowing for Skew.
+type Verifier struct {
+	Issuer      string
+	Audience    string
+	Skew        time.Duration
+	Claims      []string
+	RouteScopes map[string][]string
+	Logger      logger.Logger
+	keys        []*key
+	clock       func() time.Time
+}
+
+// New creates a Verifier from JwtConfig, loading keys from files.
+func (cfg *JwtConfig) New(lgr logger.Logger) (vf *Verifier, err error) {
+
+	vf = &Verifier{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		Skew:        cfg.Skew,
+		Claims:      cfg.Claims,
+		RouteScopes: cfg.RouteScopes,
+		Logger:      lgr,
+		clock:       time.Now,
+	}
+
+	if vf.Skew <= 0 {
+		vf.Skew = defaultSkew
+	}
+	if vf.Claims == nil {
+		vf.Claims = []string{"sub"}
+	}
+
+	jwks, err := loadJwks(cfg.JwksFile)
+	if err != nil {
+		return
+	}
+
+	pems, err := loadPem(cfg.PemFile)
+	if err != nil {
+		return
+	}
+
+	vf.keys = append(jwks, pems...)
+	if len(vf.keys) == 0 {
+		err = errors.Errorf("no jwt verification keys configured")
+	}
+	return
+}
+
+// ClaimsFromContext gets claims stored in ctx by Verifier.Wrap, nil when not found.
+func ClaimsFromContext(ctx context.Context) Claims {
+
+	claims, _ := ctx.Value(claimsKey{}).(Claims)
+	return claims
+}
+
+// Wrap is a middleware verifying jwts, responding 401 to those that fail,
+// and 403 to those without the scopes required for their route in RouteScopes.
+//
+// Selected Claims are added to ctx and to logging fields, and the subject as identity, see FromContext.
+// Routes are matched by the pattern set by http.ServeMux, so wrap handlers beneath it, see Guard.
+// With RouteScopes, requests without a pattern get 500, rather than go unchecked.
+func (vf *Verifier) Wrap(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		ctx := request.Context()
+		rp := respond.New(writer, vf.Logger)
+
+		// fail closed rather than skip scopes unseen
+		if len(vf.RouteScopes) > 0 && request.Pattern == "" {
+			rp.NotOk(ctx, http.StatusInternalServerError, errPattern)
+			return
+		}
+
+		claims, err := vf.verify(request.Header.Get("Authorization"))
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			rp.NotOk(ctx, http.StatusUnauthorized, err)
+			return
+		}
+
+		err = hasScopes(scopes(claims), vf.RouteScopes[request.Pattern])
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			rp.NotOk(ctx, http.StatusForbidden, err)
+			return
+		}
+
+		selected := Claims{}
+		kv := []any{}
+		for _, name := range vf.Claims {
+			val, ok := claims[name]
+			if ok {
+				selected[name] = val
+				kv = append(kv, name, val)
+			}
+		}
+
+		subject, _ := claims["sub"].(string)
+		ctx = With(ctx, &Identity{Name: subject, Method: Jwt})
+		ctx = context.WithValue(ctx, claimsKey{}, selected)
+		ctx = context.WithValue(ctx, scopesKey{}, scopes(claims))
+		if len(kv) > 0 {
+			ctx = vf.Logger.WithFields(ctx, kv...)
+		}
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	}
+}
+
+// RequireScopes is a middleware responding 403 unless the verified token has each of scopes.
+//
+// Wrap beforehand, else 401 is the response.
+func (vf *Verifier) RequireScopes(next http.Handler, scopes ...string) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		ctx := request.Context()
+		rp := respond.New(writer, vf.Logger)
+
+		granted, ok := ctx.Value(scopesKey{}).([]string)
+		if !ok {
+			rp.NotOk(ctx, http.StatusUnauthorized, errors.Wrapf(errToken, "not verified"))
+			return
+		}
+
+		err := hasScopes(granted, scopes)
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			rp.NotOk(ctx, http.StatusForbidden, err)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	}
+}
+
+// Guard gets a Router registering handlers with rtr behind Wrap.
+func (vf *Verifier) Guard(rtr Router) Router {
+
+	return &verified{
+		rtr: rtr,
+		vf:  vf,
+	}
+}
+
+// unexported
+
+type claimsKey struct{}
+
+type scopesKey struct{}
+
+type verified struct {
+	rtr Router
+	vf  *Verifier
+}
+
+func (vrf *verified) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+
+	vrf.rtr.HandleFunc(pattern, vrf.vf.Wrap(http.HandlerFunc(handler)))
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify verifies a bearer token's signature and registered claims, returning its claims.
+func (vf *Verifier) verify(authz string) (claims map[string]any, err error) {
+
+	scheme, token, _ := strings.Cut(authz, " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		err = errors.Wrapf(errToken, "missing bearer token")
+		return
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = errors.Wrapf(errToken, "malformed")
+		return
+	}
+
+	hdr := header{}
+	err = decodeJson(parts[0], &hdr)
+	if err != nil {
+		err = errors.Wrapf(errToken, "malformed header")
+		return
+	}
+
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		err = errors.Wrapf(errToken, "malformed signature")
+		return
+	}
+
+	if !vf.signed(hdr, []byte(parts[0]+"."+parts[1]), sig) {
+		err = errors.Wrapf(errToken, "bad signature")
+		return
+	}
+
+	err = decodeJson(parts[1], &claims)
+	if err != nil {
+		err = errors.Wrapf(errToken, "malformed claims")
+		return
+	}
+
+	err = vf.check(claims)
+	return
+}
+
+// signed checks sig with keys of alg, skipping those with an id other than kid.
+func (vf *Verifier) signed(hdr header, signed, sig []byte) bool {
+
+	for _, k := range vf.keys {
+		if k.alg != hdr.Alg || (hdr.Kid != "" && k.id != "" && k.id != hdr.Kid) {
+			continue
+		}
+		if k.verify(signed, sig) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check checks exp, nbf, iss, and aud.
+func (vf *Verifier) check(claims map[string]any) (err error) {
+
+	now := vf.clock()
+
+	exp, ok := numeric(claims["exp"])
+	if !ok {
+		err = errors.Wrapf(errToken, "missing exp")
+		return
+	}
+	if now.After(exp.Add(vf.Skew)) {
+		err = errors.Wrapf(errToken, "expired")
+		return
+	}
+
+	nbf, ok := numeric(claims["nbf"])
+	if ok && now.Add(vf.Skew).Before(nbf) {
+		err = errors.Wrapf(errToken, "not yet valid")
+		return
+	}
+
+	if vf.Issuer != "" && claims["iss"] != vf.Issuer {
+		err = errors.Wrapf(errToken, "wrong issuer")
+		return
+	}
+
+	if vf.Audience != "" && !contains(stringList(claims["aud"]), vf.Audience) {
+		err = errors.Wrapf(errToken, "wrong audience")
+		return
+	}
+
+	return
+}
+
+// scopes gets scopes from the space separated "scope", or the "scp" array or string.
+func scopes(claims map[string]any) []string {
+
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	if scp, ok := claims["scp"].(string); ok {
+		return strings.Fields(scp)
+	}
+	return stringList(claims["scp"])
+}
+
+func hasScopes(granted, required []string) (err error) {
+
+	for _, scope := range required {
+		if !contains(granted, scope) {
+			err = errors.Wrapf(errScope, "missing scope: %s", scope)
+			return
+		}
+	}
+
+	return
+}
+
+// numeric gets a NumericDate as time.
+func numeric(val any) (tm time.Time, ok bool) {
+
+	num, ok := val.(json.Number)
+	if !ok {
+		return
+	}
+
+	secs, err := num.Float64()
+	if err != nil {
+		ok = false
+		return
+	}
+
+	tm = time.Unix(0, int64(secs*float64(time.Second)))
+	return
+}
+
+// stringList gets a string or array of strings as a slice.
+func stringList(val any) (strs []string) {
+
+	switch typed := val.(type) {
+	case string:
+		strs = []string{typed}
+	case []any:
+		for _, item := range typed {
+			if str, ok := item.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+	}
+
+	return
+}
+
+func contains(strs []string, str string) bool {
+
+	for _, item := range strs {
+		if item == str {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeJson(seg string, obj any) (err error) {
+
+	data, err := decodeSegment(seg)
+	if err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err = decoder.Decode(obj)
+	err = errors.Wrapf(err, "failed to decode json")
+	return
+}
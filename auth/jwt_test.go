@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var (
+	hsSecret = []byte("this-is-a-shared-secret-of-some-length")
+	rsKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	esKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+var _ = Describe("Verifier", func() {
+	var (
+		lgr      *LoggerMock
+		cfg      *JwtConfig
+		vf       *Verifier
+		now      time.Time
+		claims   map[string]any
+		token    string
+		recorder *httptest.ResponseRecorder
+		seen     context.Context
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+
+		cfg = &JwtConfig{
+			JwksFile: writeFile("jwks.json", jwks()),
+			Issuer:   "https://gateway.example.com",
+			Audience: "items-api",
+			Claims:   []string{"sub", "tenant"},
+			RouteScopes: map[string][]string{
+				"POST /items": {"items:write"},
+			},
+		}
+
+		now = time.Unix(1700000000, 0)
+		claims = map[string]any{
+			"sub":    "svc-reporter",
+			"tenant": "acme",
+			"iss":    "https://gateway.example.com",
+			"aud":    []string{"other-api", "items-api"},
+			"exp":    now.Add(time.Minute).Unix(),
+			"scope":  "items:read",
+		}
+		token = ""
+		seen = nil
+	})
+
+	// serve serves a request with token, via rtr guarded by vf
+	serve := func(method, path string) {
+		var err error
+		vf, err = cfg.New(lgr)
+		Expect(err).ToNot(HaveOccurred())
+		vf.clock = func() time.Time { return now }
+
+		rtr := http.NewServeMux()
+		guarded := vf.Guard(rtr)
+		for _, pattern := range []string{"GET /items", "POST /items"} {
+			guarded.HandleFunc(pattern, func(writer http.ResponseWriter, request *http.Request) {
+				seen = request.Context()
+			})
+		}
+
+		request := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder = httptest.NewRecorder()
+		rtr.ServeHTTP(recorder, request)
+	}
+
+	DescribeTable("verifying a valid token",
+		func(alg, kid string, key any) {
+			token = sign(alg, kid, key, claims)
+			serve("GET", "/items")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(FromContext(seen)).To(Equal(&Identity{Name: "svc-reporter", Method: Jwt}))
+			Expect(ClaimsFromContext(seen)).To(Equal(Claims{"sub": "svc-reporter", "tenant": "acme"}))
+
+			wfc := lgr.WithFieldsCalls()
+			Expect(wfc).To(HaveLen(1))
+			Expect(wfc[0].Kv).To(Equal([]any{"sub", "svc-reporter", "tenant", "acme"}))
+		},
+		Entry("HS256", HS256, "hs", hsSecret),
+		Entry("RS256", RS256, "rs", rsKey),
+		Entry("ES256", ES256, "es", esKey),
+		Entry("ES256 without kid", ES256, "", esKey),
+	)
+
+	DescribeTable("rejecting with 401",
+		func(setup func(), expected string) {
+			setup()
+			if token == "" {
+				token = sign(RS256, "rs", rsKey, claims)
+			}
+			serve("GET", "/items")
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(Equal(`Bearer error="invalid_token"`))
+			Expect(body(recorder)).To(Equal(map[string]any{"error": expected + ": invalid token"}))
+			Expect(seen).To(BeNil())
+		},
+		Entry("missing", func() { token = " " }, "missing bearer token"),
+		Entry("malformed", func() { token = "abc.def" }, "malformed"),
+		Entry("expired", func() { claims["exp"] = now.Add(-time.Minute).Unix() }, "expired"),
+		Entry("missing exp", func() { delete(claims, "exp") }, "missing exp"),
+		Entry("not yet valid", func() { claims["nbf"] = now.Add(time.Minute).Unix() }, "not yet valid"),
+		Entry("wrong issuer", func() { claims["iss"] = "https://evil.example.com" }, "wrong issuer"),
+		Entry("wrong audience", func() { claims["aud"] = "other-api" }, "wrong audience"),
+		Entry("bad signature", func() { token = sign(RS256, "rs", mustRsa(), claims) }, "bad signature"),
+		Entry("unknown kid", func() { token = sign(RS256, "nope", rsKey, claims) }, "bad signature"),
+		Entry("alg none", func() { token = sign("none", "", nil, claims) }, "bad signature"),
+		Entry("hmac with the rsa public key", func() {
+			pub, err := x509.MarshalPKIXPublicKey(&rsKey.PublicKey)
+			Expect(err).ToNot(HaveOccurred())
+			pemPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+			token = sign(HS256, "rs", pemPub, claims)
+		}, "bad signature"),
+	)
+
+	When("within clock skew", func() {
+		BeforeEach(func() {
+			claims["exp"] = now.Add(-10 * time.Second).Unix()
+			claims["nbf"] = now.Add(10 * time.Second).Unix()
+			token = sign(ES256, "es", esKey, claims)
+		})
+
+		It("is valid", func() {
+			serve("GET", "/items")
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("route scopes", func() {
+		It("forbids a route without its required scope", func() {
+			token = sign(HS256, "hs", hsSecret, claims)
+			serve("POST", "/items")
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(Equal(`Bearer error="insufficient_scope"`))
+			Expect(body(recorder)).To(Equal(map[string]any{"error": "missing scope: items:write: insufficient scope"}))
+		})
+
+		It("allows a route with its required scope", func() {
+			claims["scope"] = "items:read items:write"
+			token = sign(HS256, "hs", hsSecret, claims)
+			serve("POST", "/items")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+
+		It("takes scopes from scp as well", func() {
+			delete(claims, "scope")
+			claims["scp"] = []string{"items:write"}
+			token = sign(HS256, "hs", hsSecret, claims)
+			serve("POST", "/items")
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	When("wrapped above the mux with route scopes", func() {
+		It("fails closed", func() {
+			var err error
+			vf, err = cfg.New(lgr)
+			Expect(err).ToNot(HaveOccurred())
+			vf.clock = func() time.Time { return now }
+
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("POST /items", func(writer http.ResponseWriter, request *http.Request) {
+				seen = request.Context()
+			})
+
+			request := httptest.NewRequest("POST", "/items", nil)
+			request.Header.Set("Authorization", "Bearer "+sign(HS256, "hs", hsSecret, claims))
+			recorder = httptest.NewRecorder()
+			vf.Wrap(rtr).ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(seen).To(BeNil())
+
+			ec := lgr.ErrorCalls()
+			Expect(ec).To(HaveLen(1))
+			Expect(ec[0].Err).To(MatchError(ContainSubstring("route scopes require a route pattern")))
+		})
+	})
+
+	Describe("requiring scopes", func() {
+		var (
+			handler http.Handler
+		)
+
+		BeforeEach(func() {
+			cfg.RouteScopes = nil
+
+			var err error
+			vf, err = cfg.New(lgr)
+			Expect(err).ToNot(HaveOccurred())
+			vf.clock = func() time.Time { return now }
+
+			handler = vf.Wrap(vf.RequireScopes(http.NotFoundHandler(), "items:admin"))
+		})
+
+		It("forbids those without", func() {
+			request := httptest.NewRequest("GET", "/items", nil)
+			request.Header.Set("Authorization", "Bearer "+sign(HS256, "hs", hsSecret, claims))
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("responds 401 when not wrapped", func() {
+			recorder = httptest.NewRecorder()
+			vf.RequireScopes(http.NotFoundHandler(), "items:admin").ServeHTTP(recorder, httptest.NewRequest("GET", "/items", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	When("keys are from pem", func() {
+		BeforeEach(func() {
+			pub, err := x509.MarshalPKIXPublicKey(&esKey.PublicKey)
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg.JwksFile = ""
+			cfg.PemFile = writeFile("pub.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})))
+		})
+
+		It("verifies with or without kid", func() {
+			token = sign(ES256, "", esKey, claims)
+			serve("GET", "/items")
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			token = sign(ES256, "some-kid", esKey, claims)
+			serve("GET", "/items")
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	DescribeTable("rejecting bad config",
+		func(cfg *JwtConfig, expected string) {
+			_, err := cfg.New(lgr)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("no keys", &JwtConfig{}, "no jwt verification keys configured"),
+		Entry("missing jwks", &JwtConfig{JwksFile: "/does/not/exist"}, "failed to read jwks"),
+		Entry("bad jwks", &JwtConfig{JwksFile: writeFile("bad.json", "{")}, "failed to decode jwks"),
+		Entry("unsupported kty", &JwtConfig{JwksFile: writeFile("okp.json", `{"keys":[{"kty":"OKP"}]}`)}, "unsupported key type: OKP"),
+		Entry("mismatched alg", &JwtConfig{JwksFile: writeFile("alg.json", `{"keys":[{"kty":"oct","k":"c2Vrcml0","alg":"RS256"}]}`)}, "unsupported alg: RS256"),
+		Entry("empty pem", &JwtConfig{PemFile: writeFile("empty.pem", "nope")}, "no public keys in"),
+	)
+})
+
+func jwks() string {
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	pad := func(n *big.Int) string {
+		buf := make([]byte, 32)
+		return b64(n.FillBytes(buf))
+	}
+
+	data, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64(hsSecret)},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "n": b64(rsKey.N.Bytes()), "e": b64(big.NewInt(int64(rsKey.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": pad(esKey.X), "y": pad(esKey.Y)}, //nolint:staticcheck // fine in test
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	if err != nil {
+		panic(err)
+	}
+
+	return string(data)
+}
+
+func sign(alg, kid string, key any, claims map[string]any) string {
+
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	hdr := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		hdr["kid"] = kid
+	}
+	hdrJson, _ := json.Marshal(hdr)
+	claimsJson, _ := json.Marshal(claims)
+
+	signed := b64(hdrJson) + "." + b64(claimsJson)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte)) //nolint:forcetypeassert // panic ok in test
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case RS256:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:]) //nolint:forcetypeassert // panic ok in test
+	case ES256:
+		r, s, _ := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:]) //nolint:forcetypeassert // panic ok in test
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func mustRsa() *rsa.PrivateKey {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).ToNot(HaveOccurred())
+
+	return key
+}
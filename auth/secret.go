@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// secret is a named token or key, kept as a digest so that compares are of equal length.
+type secret struct {
+	name string
+	sum  [sha256.Size]byte
+}
+
+// identify finds the secret matching given, comparing with each, so timing does not tell which.
+func identify(secrets []secret, given, method string) (id *Identity, err error) {
+
+	sum := sha256.Sum256([]byte(given))
+
+	name := ""
+	for _, sec := range secrets {
+		if subtle.ConstantTimeCompare(sec.sum[:], sum[:]) == 1 {
+			name = sec.name
+		}
+	}
+
+	if name == "" {
+		err = errInvalid
+		return
+	}
+
+	id = &Identity{Name: name, Method: method}
+	return
+}
+
+func loadSecrets(path string) (secrets []secret, err error) {
+
+	pairs, err := readPairs(path)
+	if err != nil {
+		return
+	}
+
+	for _, pair := range pairs {
+		secrets = append(secrets, secret{name: pair[0], sum: sha256.Sum256([]byte(pair[1]))})
+	}
+
+	return
+}
+
+func loadUsers(path string) (users map[string][]byte, err error) {
+
+	pairs, err := readPairs(path)
+	if err != nil {
+		return
+	}
+
+	users = map[string][]byte{}
+	for _, pair := range pairs {
+		hash := []byte(pair[1])
+
+		_, err = bcrypt.Cost(hash)
+		if err != nil {
+			err = errors.Wrapf(err, "not a bcrypt hash for user: %s in: %s", pair[0], path)
+			return
+		}
+
+		users[pair[0]] = hash
+	}
+
+	return
+}
+
+// dummyHash hashes at the cost of those given, for unknown users to compare against.
+func dummyHash(users map[string][]byte) (hash []byte, err error) {
+
+	cost := bcrypt.DefaultCost
+	for _, stored := range users {
+		cost, _ = bcrypt.Cost(stored)
+	}
+
+	hash, err = bcrypt.GenerateFromPassword([]byte("not-a-password"), cost)
+	err = errors.Wrapf(err, "failed to generate dummy hash")
+	return
+}
+
+// readPairs reads name:value lines, skipping blanks and comments, with nothing read when path is blank.
+//
+// Values are left out of errors, as they are secret.
+func readPairs(path string) (pairs [][2]string, err error) {
+
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read credentials")
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || value == "" {
+			err = errors.Errorf("malformed line: %d in: %s", number, path)
+			return
+		}
+
+		pairs = append(pairs, [2]string{name, value})
+	}
+
+	return
+}
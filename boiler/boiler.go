@@ -9,6 +9,8 @@ import (
 
 	"github.com/clarktrimble/delish"
 	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/metrics"
+	"github.com/clarktrimble/delish/mid"
 	"gopkg.in/yaml.v3"
 )
 
@@ -50,6 +52,21 @@ func Register(ctx context.Context, rtr Router, cfg any, spec []byte, lgr logger.
 	rtr.HandleFunc("GET /elements.min.css", gzipHandler(elementsCss, "text/css"))
 }
 
+// RegisterLogging adds routes to rtr for adjusting request logging settings at runtime,
+// and for getting slow request counts.
+func RegisterLogging(ctx context.Context, rtr Router, lg *mid.Logging, lgr logger.Logger) {
+
+	rtr.HandleFunc("GET /log/settings", delish.GetLogSettings(ctx, lg, lgr))
+	rtr.HandleFunc("PUT /log/settings", delish.LogSettings(ctx, lg, lgr))
+	rtr.HandleFunc("GET /log/slow", delish.GetSlowRequests(ctx, lg, lgr))
+}
+
+// RegisterMetrics adds a route to rtr serving metrics in Prometheus text exposition format.
+func RegisterMetrics(rtr Router, mtr *metrics.Metrics) {
+
+	rtr.HandleFunc("GET /metrics", mtr.Handler())
+}
+
 // unexported
 
 func staticHandler(body []byte, contentType string) http.HandlerFunc {
@@ -5,12 +5,15 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/clarktrimble/delish/boiler"
+	"github.com/clarktrimble/delish/metrics"
+	"github.com/clarktrimble/delish/mid"
 )
 
 //go:generate moq -pkg boiler_test -out mock_test.go ../logger Logger
@@ -176,3 +179,163 @@ var _ = Describe("Register", func() {
 		})
 	})
 })
+
+var _ = Describe("RegisterLogging", func() {
+	var (
+		ctx context.Context
+		lg  *mid.Logging
+		lgr *LoggerMock
+		rtr *http.ServeMux
+		rec *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+		lg = mid.NewLogging(lgr, mid.WithSkipBody())
+
+		rtr = http.NewServeMux()
+		boiler.RegisterLogging(ctx, rtr, lg, lgr)
+		rec = httptest.NewRecorder()
+	})
+
+	When("requesting /log/settings", func() {
+		It("returns settings as json", func() {
+			req := httptest.NewRequest("GET", "/log/settings", nil)
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"log_settings":{
+				"redact_headers":[],
+				"allow_headers":[],
+				"redact_fields":[],
+				"redact_query":[],
+				"mask_routes":[],
+				"trusted_proxies":[],
+				"skip_pattern":"",
+				"skip_preflight":false,
+				"skip_body":true,
+				"body_pattern":"",
+				"body_limit":4096,
+				"buffer_limit":1048576,
+				"stream_pattern":"",
+				"stream_types":["text/event-stream","application/octet-stream"],
+				"sampler":null,
+				"slow":{"info":"","error":""},
+				"slow_routes":{}
+			}}`))
+		})
+	})
+
+	When("requesting /log/slow", func() {
+		It("returns slow request counts as json", func() {
+			req := httptest.NewRequest("GET", "/log/slow", nil)
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"slow_requests":{"total":0,"routes":{}}}`))
+		})
+	})
+
+	When("putting /log/settings", func() {
+		It("applies, logs, and returns settings", func() {
+			req := httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{
+				"redact_headers":["Cookie"],
+				"skip_body":true,
+				"body_pattern":"^/users",
+				"buffer_limit":1024,
+				"sampler":{"rate":0.1,"slow":"500ms"},
+				"slow_routes":{"GET /reports":{"error":"10s"}}
+			}`))
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"log_settings":{
+				"redact_headers":["Cookie"],
+				"allow_headers":[],
+				"redact_fields":[],
+				"redact_query":[],
+				"mask_routes":[],
+				"trusted_proxies":[],
+				"skip_pattern":"",
+				"skip_preflight":false,
+				"skip_body":true,
+				"body_pattern":"^/users",
+				"body_limit":4096,
+				"buffer_limit":1024,
+				"stream_pattern":"",
+				"stream_types":["text/event-stream","application/octet-stream"],
+				"sampler":{"rate":0.1,"routes":{},"slow":"500ms","client_cap":0,"route_cap":0},
+				"slow":{"info":"","error":""},
+				"slow_routes":{"GET /reports":{"info":"","error":"10s"}}
+			}}`))
+
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Msg).To(Equal("logging settings updated"))
+		})
+
+		It("keeps settings left out, clearing those given as null", func() {
+			req := httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{"redact_headers":["Cookie"],"buffer_limit":1024}`))
+			rtr.ServeHTTP(httptest.NewRecorder(), req)
+
+			req = httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{"body_pattern":"^/users","redact_headers":null}`))
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			settings := lg.Settings()
+			Expect(settings.RedactHeaders).To(BeEmpty())
+			Expect(settings.BodyPattern).To(Equal("^/users"))
+			Expect(settings.SkipBody).To(BeTrue())
+			Expect(settings.BufferLimit).To(Equal(1024))
+		})
+
+		It("responds with too large when the body is", func() {
+			req := httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{"skip_pattern":"`+strings.Repeat("x", 64<<10)+`"}`))
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(lg.Settings().SkipPattern).To(BeEmpty())
+		})
+
+		It("responds with bad request when the pattern is invalid", func() {
+			req := httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{"skip_pattern":"(oops"}`))
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(rec.Body.String()).To(ContainSubstring("failed to compile pattern"))
+			Expect(lg.Settings().SkipBody).To(BeTrue())
+		})
+
+		It("responds with bad request when the body is not settings", func() {
+			req := httptest.NewRequest("PUT", "/log/settings", strings.NewReader(`{"skip_bodies":true}`))
+			rtr.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(rec.Body.String()).To(ContainSubstring("failed to decode log settings"))
+		})
+	})
+})
+
+var _ = Describe("RegisterMetrics", func() {
+
+	It("serves metrics in text exposition format", func() {
+		rtr := http.NewServeMux()
+		mtr := (&metrics.Config{}).New()
+		boiler.RegisterMetrics(rtr, mtr)
+
+		handler := mtr.Measure(rtr)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal(metrics.ContentType))
+		Expect(rec.Body.String()).To(ContainSubstring(`http_requests_total{method="GET",route="GET /metrics",status="2xx"} 1` + "\n"))
+		Expect(rec.Body.String()).To(ContainSubstring("# TYPE go_goroutines gauge\n"))
+	})
+})
@@ -5,18 +5,76 @@ package buffered
 **/
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"net"
 	"net/http"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
-// Buffered implements http.ResponseWriter
-// buffering the response and providing access to the body
+const (
+	// maxPooled is the largest buffer capacity returned to the pool.
+	maxPooled int = 64 << 10
+)
+
+var (
+	pool = sync.Pool{
+		New: func() any { return &Buffered{} },
+	}
+)
+
+// Buffered implements http.ResponseWriter and http.Flusher
+// buffering the response and providing access to the body.
+//
+// The first Flush writes buffered status, headers, and body, switching to pass-through.
+// Buffer then holds only the prefix written ahead of the flush.
+//
+// When Limit is non-zero, a write beyond it spills over, as with Flush,
+// retaining only the first Limit bytes in Buffer and marking it Truncated.
+//
+// When Stream is set and reports true for the header at the first write,
+// the response is passed through from the start, with nothing buffered.
+//
+// Hijacker, ReaderFrom, and Pusher are passed through to Writer when supported,
+// and Unwrap gives http.ResponseController access to the rest.
 type Buffered struct {
-	Writer http.ResponseWriter
-	Status int
-	Buffer bytes.Buffer
+	Writer    http.ResponseWriter
+	Status    int
+	Buffer    bytes.Buffer
+	Limit     int
+	Streamed  bool
+	Truncated bool
+	Hijacked  bool
+	Size      int
+	Stream    func(header http.Header) bool
+	err       error
+}
+
+// Get gets a Buffered for writer from the pool.
+//
+// Release when done to cut allocations on the hot path.
+func Get(writer http.ResponseWriter, limit int) (buf *Buffered) {
+
+	buf = pool.Get().(*Buffered) //nolint:forcetypeassert // only ever Buffered
+	buf.Writer = writer
+	buf.Limit = limit
+
+	return
+}
+
+// Release resets buf and returns it to the pool, after which it must not be used.
+func (buf *Buffered) Release() {
+
+	if buf.Buffer.Cap() > maxPooled {
+		return
+	}
+
+	buf.Buffer.Reset()
+	*buf = Buffered{Buffer: buf.Buffer}
+	pool.Put(buf)
 }
 
 // Header returns header
@@ -25,22 +83,127 @@ func (buf *Buffered) Header() http.Header {
 	return buf.Writer.Header()
 }
 
-// Write buffers the response
-func (buf *Buffered) Write(body []byte) (int, error) {
+// Write buffers the response, or passes it through once streamed or over limit
+func (buf *Buffered) Write(body []byte) (count int, err error) {
 
 	if buf.Status == 0 {
 		buf.Status = 200
 	}
 
-	return buf.Buffer.Write(body)
+	err = buf.stream()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case buf.Streamed:
+		count, err = buf.Writer.Write(body)
+	case buf.Limit > 0 && buf.Buffer.Len()+len(body) > buf.Limit:
+		count, err = buf.spill(body)
+	default:
+		count, err = buf.Buffer.Write(body)
+	}
+
+	buf.Size += count
+	return
 }
 
-// WriteHeader stores the status code
+// WriteHeader stores the status code, ignored once streamed as with the stdlib
 func (buf *Buffered) WriteHeader(status int) {
 
+	if buf.Streamed {
+		return
+	}
+
 	buf.Status = status
 }
 
+// Flush writes out anything buffered, switching to pass-through, and flushes the writer
+func (buf *Buffered) Flush() {
+
+	_ = buf.FlushError()
+}
+
+// FlushError is Flush returning an error, as preferred by http.ResponseController
+func (buf *Buffered) FlushError() (err error) {
+
+	if !buf.Streamed {
+		buf.Streamed = true
+		buf.err = buf.write()
+		if buf.err != nil {
+			return buf.err
+		}
+	}
+
+	err = http.NewResponseController(buf.Writer).Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		err = nil
+	}
+	return
+}
+
+// Hijack hands over the connection when supported by the writer
+//
+// Once hijacked, nothing buffered is written.
+func (buf *Buffered) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+
+	conn, rw, err = http.NewResponseController(buf.Writer).Hijack()
+	if err != nil {
+		return
+	}
+
+	buf.Hijacked = true
+	return
+}
+
+// ReadFrom buffers from reader, or passes it through once streamed
+func (buf *Buffered) ReadFrom(reader io.Reader) (count int64, err error) {
+
+	if buf.Status == 0 {
+		buf.Status = 200
+	}
+
+	err = buf.stream()
+	if err != nil {
+		return
+	}
+
+	if !buf.Streamed && buf.Limit > 0 {
+		// via Write to enforce limit, which also counts size
+		return io.Copy(writerOnly{buf}, reader)
+	}
+
+	readerFrom, ok := buf.Writer.(io.ReaderFrom)
+	switch {
+	case !buf.Streamed:
+		count, err = buf.Buffer.ReadFrom(reader)
+	case ok:
+		count, err = readerFrom.ReadFrom(reader)
+	default:
+		count, err = io.Copy(writerOnly{buf.Writer}, reader)
+	}
+
+	buf.Size += int(count)
+	return
+}
+
+// Push initiates an http/2 server push when supported by the writer
+func (buf *Buffered) Push(target string, opts *http.PushOptions) error {
+
+	pusher, ok := buf.Writer.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+
+	return pusher.Push(target, opts)
+}
+
+// Unwrap returns the underlying writer for use by http.ResponseController
+func (buf *Buffered) Unwrap() http.ResponseWriter {
+
+	return buf.Writer
+}
+
 // Body gets the buffered response body
 func (buf *Buffered) Body() string {
 
@@ -48,16 +211,69 @@ func (buf *Buffered) Body() string {
 }
 
 // WriteResponse writes to the response writer
+//
+// Once streamed, only the outcome of writing at first flush is reported.
+// Once hijacked, nothing is written.
 func (buf *Buffered) WriteResponse() (err error) {
 
+	if buf.Streamed || buf.Hijacked {
+		return buf.err
+	}
+
+	return buf.write()
+}
+
+// unexported
+
+// stream switches to pass-through ahead of the first write when Stream reports so.
+func (buf *Buffered) stream() (err error) {
+
+	if buf.Streamed || buf.Stream == nil || buf.Size > 0 || !buf.Stream(buf.Header()) {
+		return
+	}
+
+	buf.Streamed = true
+	buf.err = buf.write()
+	return buf.err
+}
+
+func (buf *Buffered) spill(body []byte) (count int, err error) {
+
+	fit := buf.Limit - buf.Buffer.Len()
+	buf.Buffer.Write(body[:fit])
+
+	buf.Streamed = true
+	buf.Truncated = true
+
+	buf.err = buf.write()
+	if buf.err != nil {
+		err = buf.err
+		return
+	}
+
+	count, err = buf.Writer.Write(body[fit:])
+	count += fit
+	return
+}
+
+func (buf *Buffered) write() (err error) {
+
+	if buf.Status == 0 {
+		buf.Status = 200
+	}
 	buf.Writer.WriteHeader(buf.Status)
 
+	// writing nothing could still fail, as after 204
+	if buf.Buffer.Len() == 0 {
+		return
+	}
+
 	_, err = buf.Writer.Write(buf.Buffer.Bytes())
 	err = errors.Wrapf(err, "failed to write response")
 	return
 }
 
-// Note: Flush free!!
-// Half-ass implementation broke templ.
-// Maybe this is worth fixing, but needs real thought.
-// And solid testing.
+// writerOnly hides any ReadFrom so io.Copy does not recurse.
+type writerOnly struct {
+	io.Writer
+}
@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -159,6 +161,7 @@ var _ = Describe("Buf", func() {
 			BeforeEach(func() {
 				buf = &Buffered{
 					Writer: &errorResponder{},
+					Buffer: *(bytes.NewBufferString(`{"ima": "pc"}`)),
 				}
 			})
 
@@ -167,10 +170,465 @@ var _ = Describe("Buf", func() {
 			})
 		})
 
+		When("there is no body", func() {
+			BeforeEach(func() {
+				buf = &Buffered{
+					Writer: &errorResponder{},
+					Status: 204,
+				}
+			})
+
+			It("does not write one", func() {
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+	})
+
+	Describe("flushing", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			buf = &Buffered{
+				Writer: recorder,
+			}
+		})
+
+		JustBeforeEach(func() {
+			buf.Flush()
+		})
+
+		When("status and body are buffered", func() {
+			BeforeEach(func() {
+				buf.Header().Set("content-type", "text/event-stream")
+				buf.WriteHeader(201)
+				_, err := buf.Write([]byte("data: one\n\n"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("writes them out, flushes, and switches to streaming", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(recorder.Flushed).To(BeTrue())
+				Expect(recorder.Code).To(Equal(201))
+				Expect(recorder.Header()).To(Equal(http.Header{"Content-Type": []string{"text/event-stream"}}))
+				Expect(recorder.Body.String()).To(Equal("data: one\n\n"))
+			})
+
+			When("and more is written", func() {
+				JustBeforeEach(func() {
+					buf.WriteHeader(500)
+					_, err := buf.Write([]byte("data: two\n\n"))
+					Expect(err).ToNot(HaveOccurred())
+					buf.Flush()
+				})
+
+				It("passes it through, retaining the prefix and counting bytes", func() {
+					Expect(recorder.Code).To(Equal(201))
+					Expect(recorder.Body.String()).To(Equal("data: one\n\ndata: two\n\n"))
+					Expect(buf.Status).To(Equal(201))
+					Expect(buf.Body()).To(Equal("data: one\n\n"))
+					Expect(buf.Size).To(Equal(22))
+				})
+
+				It("does not write the response again", func() {
+					Expect(buf.WriteResponse()).To(Succeed())
+					Expect(recorder.Body.String()).To(Equal("data: one\n\ndata: two\n\n"))
+				})
+			})
+		})
+
+		When("nothing is buffered", func() {
+
+			It("writes ok status", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(buf.Status).To(Equal(200))
+				Expect(recorder.Code).To(Equal(200))
+				Expect(recorder.Body.String()).To(Equal(""))
+			})
+		})
+
+		When("the writer is not a flusher and write fails", func() {
+			BeforeEach(func() {
+				buf = &Buffered{
+					Writer: &errorResponder{},
+					Buffer: *(bytes.NewBufferString("data: one\n\n")),
+				}
+			})
+
+			It("reports the error when writing the response", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(buf.WriteResponse()).To(MatchError(ContainSubstring("failed to write response")))
+			})
+		})
+	})
+
+	Describe("getting from and releasing to the pool", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+		})
+
+		JustBeforeEach(func() {
+			buf = Get(recorder, 9)
+		})
+
+		When("all is well", func() {
+			It("is ready for the writer", func() {
+				Expect(buf.Writer).To(Equal(recorder))
+				Expect(buf.Limit).To(Equal(9))
+				Expect(buf.Body()).To(Equal(""))
+			})
+
+			It("is reset on release", func() {
+				buf.WriteHeader(201)
+				_, err := buf.Write([]byte("data"))
+				Expect(err).ToNot(HaveOccurred())
+				buf.Flush()
+
+				buf.Release()
+				Expect(*buf).To(Equal(Buffered{Buffer: buf.Buffer}))
+				Expect(buf.Buffer.Len()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("writing beyond the limit", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			buf = &Buffered{
+				Writer: recorder,
+				Limit:  5,
+			}
+			buf.WriteHeader(201)
+		})
+
+		When("writes stay under the limit", func() {
+			BeforeEach(func() {
+				_, err := buf.Write([]byte("01234"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("buffers", func() {
+				Expect(buf.Streamed).To(BeFalse())
+				Expect(buf.Truncated).To(BeFalse())
+				Expect(buf.Body()).To(Equal("01234"))
+				Expect(recorder.Body.String()).To(Equal(""))
+			})
+		})
+
+		When("writes cross the limit", func() {
+			BeforeEach(func() {
+				for _, chunk := range []string{"012", "3456", "789"} {
+					count, err := buf.Write([]byte(chunk))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(count).To(Equal(len(chunk)))
+				}
+			})
+
+			It("retains the prefix and spills over", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(buf.Truncated).To(BeTrue())
+				Expect(buf.Body()).To(Equal("01234"))
+				Expect(buf.Size).To(Equal(10))
+
+				Expect(recorder.Code).To(Equal(201))
+				Expect(recorder.Body.String()).To(Equal("0123456789"))
+
+				Expect(buf.WriteResponse()).To(Succeed())
+				Expect(recorder.Body.String()).To(Equal("0123456789"))
+			})
+		})
+
+		When("reading from crosses the limit", func() {
+			BeforeEach(func() {
+				count, err := buf.ReadFrom(bytes.NewBufferString("0123456789"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(10))
+			})
+
+			It("retains the prefix and spills over", func() {
+				Expect(buf.Truncated).To(BeTrue())
+				Expect(buf.Body()).To(Equal("01234"))
+				Expect(buf.Size).To(Equal(10))
+				Expect(recorder.Body.String()).To(Equal("0123456789"))
+			})
+		})
+
+		When("spilling over fails to write", func() {
+			BeforeEach(func() {
+				buf.Writer = &errorResponder{}
+			})
+
+			It("returns an error", func() {
+				_, err := buf.Write([]byte("0123456789"))
+				Expect(err).To(MatchError(ContainSubstring("failed to write response")))
+				Expect(buf.WriteResponse()).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("streaming by header", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			buf = &Buffered{
+				Writer: recorder,
+				Stream: func(header http.Header) bool {
+					return header.Get("Content-Type") == "application/octet-stream"
+				},
+			}
+		})
+
+		When("the header calls for streaming", func() {
+			BeforeEach(func() {
+				buf.Header().Set("Content-Type", "application/octet-stream")
+				buf.WriteHeader(202)
+
+				for _, chunk := range []string{"012", "3456"} {
+					_, err := buf.Write([]byte(chunk))
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+
+			It("passes through from the first write, buffering nothing", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(buf.Truncated).To(BeFalse())
+				Expect(buf.Body()).To(Equal(""))
+				Expect(buf.Size).To(Equal(7))
+
+				Expect(recorder.Code).To(Equal(202))
+				Expect(recorder.Body.String()).To(Equal("0123456"))
+
+				Expect(buf.WriteResponse()).To(Succeed())
+				Expect(recorder.Body.String()).To(Equal("0123456"))
+			})
+		})
+
+		When("the header does not", func() {
+			BeforeEach(func() {
+				buf.Header().Set("Content-Type", "application/json")
+
+				_, err := buf.ReadFrom(bytes.NewBufferString(`{"ima":"pc"}`))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("buffers", func() {
+				Expect(buf.Streamed).To(BeFalse())
+				Expect(buf.Body()).To(Equal(`{"ima":"pc"}`))
+				Expect(recorder.Body.String()).To(Equal(""))
+			})
+		})
+
+		When("writing through fails", func() {
+			BeforeEach(func() {
+				buf.Writer = &errorResponder{}
+				buf.Stream = func(header http.Header) bool { return true }
+			})
+
+			It("returns the error", func() {
+				_, err := buf.Write([]byte("0123456789"))
+				Expect(err).To(MatchError("oops"))
+				Expect(buf.Streamed).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("passing through optional interfaces", func() {
+		var (
+			fake *fakeWriter
+		)
+
+		BeforeEach(func() {
+			fake = &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+			buf = &Buffered{
+				Writer: fake,
+			}
+		})
+
+		It("unwraps to the writer", func() {
+			Expect(buf.Unwrap()).To(Equal(fake))
+		})
+
+		When("reading from before streaming", func() {
+
+			It("buffers", func() {
+				count, err := buf.ReadFrom(bytes.NewBufferString(`{"ima": "pc"}`))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(13))
+				Expect(buf.Body()).To(Equal(`{"ima": "pc"}`))
+				Expect(fake.readFrom).To(BeFalse())
+			})
+		})
+
+		When("reading from once streaming", func() {
+			BeforeEach(func() {
+				buf.Flush()
+			})
+
+			It("uses the writer's ReadFrom", func() {
+				count, err := buf.ReadFrom(bytes.NewBufferString(`{"ima": "pc"}`))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(13))
+				Expect(fake.readFrom).To(BeTrue())
+				Expect(fake.Body.String()).To(Equal(`{"ima": "pc"}`))
+				Expect(buf.Size).To(Equal(13))
+			})
+		})
+
+		When("pushing", func() {
+
+			It("pushes with the writer", func() {
+				Expect(buf.Push("/style.css", nil)).To(Succeed())
+				Expect(fake.pushed).To(Equal("/style.css"))
+			})
+		})
+
+		When("the writer does not support them", func() {
+			BeforeEach(func() {
+				buf = &Buffered{
+					Writer: httptest.NewRecorder(),
+				}
+			})
+
+			It("reports not supported", func() {
+				_, _, err := buf.Hijack()
+				Expect(err).To(MatchError(http.ErrNotSupported))
+				Expect(buf.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+				Expect(http.NewResponseController(buf).SetWriteDeadline(time.Now())).To(MatchError(http.ErrNotSupported))
+			})
+		})
+	})
+
+	Describe("serving via the stdlib server", func() {
+		var (
+			handler  http.HandlerFunc
+			response *http.Response
+			body     string
+		)
+
+		JustBeforeEach(func() {
+			// handed back once served, as the handler runs on the server's goroutine
+			served := make(chan *Buffered, 1)
+
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				sbuf := &Buffered{Writer: writer}
+				handler(sbuf, request)
+				Expect(sbuf.WriteResponse()).To(Succeed())
+				served <- sbuf
+			}))
+			defer server.Close()
+
+			var err error
+			response, err = http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer response.Body.Close()
+
+			data, err := io.ReadAll(response.Body)
+			Expect(err).ToNot(HaveOccurred())
+			body = string(data)
+
+			buf = <-served
+		})
+
+		When("the handler uses a response controller", func() {
+			BeforeEach(func() {
+				handler = func(writer http.ResponseWriter, request *http.Request) {
+					rc := http.NewResponseController(writer)
+					Expect(rc.SetWriteDeadline(time.Now().Add(time.Minute))).To(Succeed())
+					Expect(rc.SetReadDeadline(time.Now().Add(time.Minute))).To(Succeed())
+					Expect(rc.EnableFullDuplex()).To(Succeed())
+
+					_, err := writer.Write([]byte("one"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rc.Flush()).To(Succeed())
+					_, err = writer.Write([]byte("two"))
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+
+			It("reaches the underlying writer", func() {
+				Expect(buf.Streamed).To(BeTrue())
+				Expect(body).To(Equal("onetwo"))
+			})
+		})
+
+		When("the handler hijacks the connection", func() {
+			BeforeEach(func() {
+				handler = func(writer http.ResponseWriter, request *http.Request) {
+					_, err := writer.Write([]byte("discarded"))
+					Expect(err).ToNot(HaveOccurred())
+
+					conn, rw, err := writer.(http.Hijacker).Hijack() //nolint:forcetypeassert // panic ok in test
+					Expect(err).ToNot(HaveOccurred())
+					defer conn.Close()
+
+					_, err = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 7\r\nConnection: close\r\n\r\nhijackd")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rw.Flush()).To(Succeed())
+				}
+			})
+
+			It("hands over the connection and writes nothing further", func() {
+				Expect(buf.Hijacked).To(BeTrue())
+				Expect(body).To(Equal("hijackd"))
+			})
+		})
+
+		When("the handler sends a file", func() {
+			BeforeEach(func() {
+				handler = func(writer http.ResponseWriter, request *http.Request) {
+					writer.(http.Flusher).Flush() //nolint:forcetypeassert // panic ok in test
+
+					fh, err := os.Open("buffered.go")
+					Expect(err).ToNot(HaveOccurred())
+					defer fh.Close()
+
+					_, err = io.Copy(writer, fh)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+
+			It("streams the file and counts bytes", func() {
+				data, err := os.ReadFile("buffered.go")
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(body).To(Equal(string(data)))
+				Expect(buf.Size).To(Equal(len(data)))
+			})
+		})
 	})
 
 })
 
+type fakeWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+	pushed   string
+}
+
+func (fw *fakeWriter) ReadFrom(reader io.Reader) (int64, error) {
+	fw.readFrom = true
+	return fw.Body.ReadFrom(reader)
+}
+
+func (fw *fakeWriter) Push(target string, opts *http.PushOptions) error {
+	fw.pushed = target
+	return nil
+}
+
 type errorResponder struct{}
 
 func (er *errorResponder) Header() (hdr http.Header) {
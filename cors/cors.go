@@ -0,0 +1,262 @@
+// Package cors provides a middleware answering CORS preflight requests and
+// adding CORS headers to responses for allowed origins.
+package cors
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clarktrimble/delish/requestid"
+	"github.com/pkg/errors"
+)
+
+const (
+	wildcard string = "*"
+)
+
+var (
+	// DefaultMethods are allowed when none are configured.
+	DefaultMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost,
+		http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}
+	// DefaultExposeHeaders are exposed when none are configured.
+	DefaultExposeHeaders = []string{requestid.Header}
+)
+
+// Config is the cors configuration.
+type Config struct {
+	AllowOrigins        []string      `json:"allow_origins" desc:"origins allowed, such as https://app.example.com, https://*.example.com, or * for any"`
+	AllowOriginPatterns []string      `json:"allow_origin_patterns" desc:"regular expressions matching whole origins allowed"`
+	AllowMethods        []string      `json:"allow_methods" desc:"methods allowed" default:"GET,HEAD,POST,PUT,PATCH,DELETE"`
+	AllowHeaders        []string      `json:"allow_headers" desc:"request headers allowed, or * for any"`
+	ExposeHeaders       []string      `json:"expose_headers" desc:"response headers exposed to scripts" default:"X-Request-Id"`
+	AllowCredentials    bool          `json:"allow_credentials" desc:"allow cookies and authorization, not along with * for any origin"`
+	MaxAge              time.Duration `json:"max_age" desc:"how long preflight responses may be cached, not sent when zero"`
+}
+
+// Cors answers preflight requests and adds CORS headers to responses for allowed origins.
+//
+// Origins are allowed when equal to one of AllowOrigins, in any case, or matching one with a wildcard
+// such as "https://*.example.com", or matching one of AllowOriginPatterns in whole.
+// The allowed origin is echoed back, rather than "*".
+// Credentials are not allowed along with any origin, as then any site could act with a caller's cookies.
+// Responses vary by Origin whether allowed or not, keeping caches honest.
+type Cors struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	anyOrigin        bool
+	anyHeader        bool
+	patterns         []*regexp.Regexp
+}
+
+// New creates Cors from Config.
+func (cfg *Config) New() (crs *Cors, err error) {
+
+	crs = &Cors{
+		AllowMethods:     cfg.AllowMethods,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}
+
+	if crs.AllowMethods == nil {
+		crs.AllowMethods = DefaultMethods
+	}
+	if crs.ExposeHeaders == nil {
+		crs.ExposeHeaders = DefaultExposeHeaders
+	}
+
+	for _, origin := range cfg.AllowOrigins {
+		if origin == wildcard {
+			crs.anyOrigin = true
+			continue
+		}
+		if _, err = path.Match(origin, ""); err != nil {
+			err = errors.Wrapf(err, "failed to parse allowed origin: %s", origin)
+			return
+		}
+		crs.AllowOrigins = append(crs.AllowOrigins, strings.ToLower(origin))
+	}
+
+	if crs.anyOrigin && crs.AllowCredentials {
+		err = errors.Errorf("credentials cannot be allowed along with any origin")
+		return
+	}
+
+	for _, pattern := range cfg.AllowOriginPatterns {
+		var rx *regexp.Regexp
+		rx, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			err = errors.Wrapf(err, "failed to compile allowed origin pattern")
+			return
+		}
+		crs.patterns = append(crs.patterns, rx)
+	}
+
+	for _, name := range cfg.AllowHeaders {
+		if name == wildcard {
+			crs.anyHeader = true
+			continue
+		}
+		crs.AllowHeaders = append(crs.AllowHeaders, http.CanonicalHeaderKey(name))
+	}
+
+	return
+}
+
+// Preflight reports whether request is a CORS preflight.
+func Preflight(request *http.Request) bool {
+
+	return request.Method == http.MethodOptions &&
+		request.Header.Get("Origin") != "" &&
+		request.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Wrap is a middleware answering preflight requests and adding CORS headers to other responses.
+//
+// Preflight requests are answered with no content, without calling next, as http.ServeMux would
+// otherwise respond 405 to an OPTIONS request for a method-specific pattern such as "GET /items".
+// Nothing is allowed when the origin, method, or any of the headers requested are not.
+func (crs *Cors) Wrap(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		header := writer.Header()
+		header.Add("Vary", "Origin")
+		origin := request.Header.Get("Origin")
+
+		if Preflight(request) {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			crs.preflight(header, request.Header, origin)
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if origin != "" && crs.allowsOrigin(origin) {
+			crs.allow(header, origin)
+			if len(crs.ExposeHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(crs.ExposeHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(writer, request)
+	}
+}
+
+// unexported
+
+func (crs *Cors) preflight(header, reqHeader http.Header, origin string) {
+
+	if !crs.allowsOrigin(origin) {
+		return
+	}
+
+	method := reqHeader.Get("Access-Control-Request-Method")
+	if !crs.allowsMethod(method) {
+		return
+	}
+
+	requested := splitList(reqHeader.Values("Access-Control-Request-Headers"))
+	if !crs.allowsHeaders(requested) {
+		return
+	}
+
+	crs.allow(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(crs.AllowMethods, ", "))
+
+	if len(requested) > 0 {
+		// echo what was asked, as "*" is taken literally along with credentials
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if crs.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(crs.MaxAge.Seconds())))
+	}
+}
+
+func (crs *Cors) allow(header http.Header, origin string) {
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	if crs.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (crs *Cors) allowsOrigin(origin string) bool {
+
+	if crs.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	for _, allowed := range crs.AllowOrigins {
+		if ok, _ := path.Match(allowed, lower); ok {
+			return true
+		}
+	}
+
+	for _, rx := range crs.patterns {
+		if rx.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (crs *Cors) allowsMethod(method string) bool {
+
+	for _, allowed := range crs.AllowMethods {
+		if method == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (crs *Cors) allowsHeaders(requested []string) bool {
+
+	if crs.anyHeader {
+		return true
+	}
+
+	for _, name := range requested {
+		ok := false
+		for _, allowed := range crs.AllowHeaders {
+			if http.CanonicalHeaderKey(name) == allowed {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitList(vals []string) (items []string) {
+
+	for _, val := range vals {
+		for _, item := range strings.Split(val, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, strings.ToLower(item))
+			}
+		}
+	}
+
+	return
+}
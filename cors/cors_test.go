@@ -0,0 +1,206 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCors(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cors Suite")
+}
+
+var _ = Describe("Cors", func() {
+	var (
+		cfg      *Config
+		handler  http.Handler
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		called   bool
+	)
+
+	BeforeEach(func() {
+		cfg = &Config{
+			AllowOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+			AllowOriginPatterns: []string{`https://pr-\d+\.example\.net`},
+			AllowHeaders:        []string{"content-type", "Authorization"},
+			MaxAge:              10 * time.Minute,
+		}
+		request = httptest.NewRequest("GET", "/items", nil)
+		called = false
+	})
+
+	JustBeforeEach(func() {
+		crs, err := cfg.New()
+		Expect(err).ToNot(HaveOccurred())
+
+		rtr := http.NewServeMux()
+		rtr.HandleFunc("GET /items", func(writer http.ResponseWriter, request *http.Request) {
+			called = true
+			writer.Header().Set("X-Request-Id", "abc123")
+		})
+		handler = crs.Wrap(rtr)
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+	})
+
+	Describe("preflight", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("OPTIONS", "/items", nil)
+			request.Header.Set("Origin", "https://app.example.com")
+			request.Header.Set("Access-Control-Request-Method", "PUT")
+			request.Header.Set("Access-Control-Request-Headers", "Content-Type, authorization")
+		})
+
+		When("all is allowed", func() {
+			It("answers without routing, so the mux does not respond 405", func() {
+				Expect(called).To(BeFalse())
+				Expect(recorder.Code).To(Equal(http.StatusNoContent))
+				Expect(recorder.Header()).To(Equal(http.Header{
+					"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+					"Access-Control-Allow-Origin":  {"https://app.example.com"},
+					"Access-Control-Allow-Methods": {"GET, HEAD, POST, PUT, PATCH, DELETE"},
+					"Access-Control-Allow-Headers": {"content-type, authorization"},
+					"Access-Control-Max-Age":       {"600"},
+				}))
+			})
+		})
+
+		When("the origin is not allowed", func() {
+			BeforeEach(func() {
+				request.Header.Set("Origin", "https://evil.example.com")
+			})
+
+			It("allows nothing", func() {
+				Expect(recorder.Code).To(Equal(http.StatusNoContent))
+				Expect(recorder.Header()).To(Equal(http.Header{
+					"Vary": {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+				}))
+			})
+		})
+
+		When("the method is not allowed", func() {
+			BeforeEach(func() {
+				cfg.AllowMethods = []string{"GET"}
+			})
+
+			It("allows nothing", func() {
+				Expect(recorder.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+			})
+		})
+
+		When("a header is not allowed", func() {
+			BeforeEach(func() {
+				request.Header.Set("Access-Control-Request-Headers", "content-type, x-secret")
+			})
+
+			It("allows nothing", func() {
+				Expect(recorder.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+			})
+		})
+
+		When("any header is allowed, with credentials", func() {
+			BeforeEach(func() {
+				cfg.AllowHeaders = []string{"*"}
+				cfg.AllowCredentials = true
+				request.Header.Set("Access-Control-Request-Headers", "x-secret")
+			})
+
+			It("echoes the headers requested", func() {
+				Expect(recorder.Header().Get("Access-Control-Allow-Headers")).To(Equal("x-secret"))
+				Expect(recorder.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+			})
+		})
+	})
+
+	Describe("actual request", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/items", nil)
+			request.Header.Set("Origin", "https://app.example.com")
+		})
+
+		When("the origin is allowed", func() {
+			It("adds cors headers and routes", func() {
+				Expect(called).To(BeTrue())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Header()).To(Equal(http.Header{
+					"Vary":                          {"Origin"},
+					"Access-Control-Allow-Origin":   {"https://app.example.com"},
+					"Access-Control-Expose-Headers": {"X-Request-Id"},
+					"X-Request-Id":                  {"abc123"},
+				}))
+			})
+		})
+
+		When("the origin is not allowed", func() {
+			BeforeEach(func() {
+				request.Header.Set("Origin", "https://evil.example.com")
+			})
+
+			It("routes with only vary added", func() {
+				Expect(called).To(BeTrue())
+				Expect(recorder.Header()).To(Equal(http.Header{
+					"Vary":         {"Origin"},
+					"X-Request-Id": {"abc123"},
+				}))
+			})
+		})
+
+		When("an options request is not a preflight", func() {
+			BeforeEach(func() {
+				request = httptest.NewRequest("OPTIONS", "/items", nil)
+				request.Header.Set("Origin", "https://app.example.com")
+			})
+
+			It("is routed", func() {
+				Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	DescribeTable("allowing origins",
+		func(origin string, expected bool) {
+			crs, err := cfg.New()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(crs.allowsOrigin(origin)).To(Equal(expected))
+		},
+		Entry("exact", "https://app.example.com", true),
+		Entry("exact in any case", "HTTPS://App.Example.com", true),
+		Entry("other scheme", "http://app.example.com", false),
+		Entry("other port", "https://app.example.com:8443", false),
+		Entry("wildcard", "https://shop.example.org", true),
+		Entry("wildcard bare domain", "https://example.org", false),
+		Entry("wildcard suffix trick", "https://shop.example.org.evil.com", false),
+		Entry("pattern", "https://pr-42.example.net", true),
+		Entry("pattern in whole", "https://pr-42.example.net.evil.com", false),
+		Entry("null", "null", false),
+	)
+
+	When("any origin is allowed", func() {
+		BeforeEach(func() {
+			cfg.AllowOrigins = []string{"*"}
+			request = httptest.NewRequest("GET", "/items", nil)
+			request.Header.Set("Origin", "https://anywhere.example.com")
+		})
+
+		It("echoes the origin", func() {
+			Expect(recorder.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://anywhere.example.com"))
+		})
+	})
+
+	DescribeTable("rejecting bad config",
+		func(cfg *Config, expected string) {
+			_, err := cfg.New()
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("bad glob", &Config{AllowOrigins: []string{"https://[.example.com"}}, "failed to parse allowed origin"),
+		Entry("bad pattern", &Config{AllowOriginPatterns: []string{"(oops"}}, "failed to compile allowed origin pattern"),
+		Entry("credentials with any origin", &Config{AllowOrigins: []string{"*"}, AllowCredentials: true}, "credentials cannot be allowed along with any origin"),
+	)
+})
@@ -2,8 +2,11 @@
 package delish
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -14,6 +17,10 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	maxSettingsBytes int64 = 64 << 10
+)
+
 // Config is the server's configuration
 type Config struct {
 	Host    string        `json:"host" desc:"hostname or ip for which to bind"`
@@ -43,10 +50,27 @@ func (cfg *Config) New(handler http.Handler, lgr logger.Logger) (svr *Server) {
 }
 
 // NewWithLog is a convinience creating a server wrapped with logging from config.
-func (cfg *Config) NewWithLog(ctx context.Context, handler http.Handler, lgr logger.Logger) (svr *Server) {
+//
+// Logging is configured by opts, or by mid's package vars when none are given.
+func (cfg *Config) NewWithLog(ctx context.Context, handler http.Handler, lgr logger.Logger, opts ...mid.Option) (svr *Server) {
+
+	if len(opts) == 0 {
+		handler = mid.LogResponse(lgr, handler)
+		handler = mid.LogRequest(lgr, handler)
+		handler = mid.ReplaceCtx(ctx, handler)
+
+		svr = cfg.New(handler, lgr)
+		return
+	}
 
-	handler = mid.LogResponse(lgr, handler)
-	handler = mid.LogRequest(lgr, handler)
+	svr = cfg.NewWithLogging(ctx, handler, mid.NewLogging(lgr, opts...), lgr)
+	return
+}
+
+// NewWithLogging creates a server wrapped with logging, such that lg can be adjusted at runtime.
+func (cfg *Config) NewWithLogging(ctx context.Context, handler http.Handler, lg *mid.Logging, lgr logger.Logger) (svr *Server) {
+
+	handler = lg.Wrap(handler)
 	handler = mid.ReplaceCtx(ctx, handler)
 
 	svr = cfg.New(handler, lgr)
@@ -106,6 +130,56 @@ func GetLogLevel(ctx context.Context, lgr logger.Logger) http.HandlerFunc {
 	}
 }
 
+// GetLogSettings responds with request logging settings.
+func GetLogSettings(ctx context.Context, lg *mid.Logging, lgr logger.Logger) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		respond.New(writer, lgr).WriteObjects(ctx, map[string]any{"log_settings": lg.Settings()})
+	}
+}
+
+// LogSettings updates request logging settings with those given, responding with the result.
+//
+// Settings left out keep their current values, and those given as null are cleared.
+func LogSettings(ctx context.Context, lg *mid.Logging, lgr logger.Logger) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		rp := respond.New(writer, lgr)
+
+		data, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, maxSettingsBytes))
+		if err != nil {
+			code := http.StatusBadRequest
+			if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			rp.NotOk(ctx, code, errors.Wrapf(err, "failed to read log settings"))
+			return
+		}
+
+		err = lg.Update(ctx, func(settings *mid.Settings) error {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+
+			err := decoder.Decode(settings)
+			return errors.Wrapf(err, "failed to decode log settings")
+		})
+		if err != nil {
+			rp.NotOk(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		rp.WriteObjects(ctx, map[string]any{"log_settings": lg.Settings()})
+	}
+}
+
+// GetSlowRequests responds with counts of slow requests.
+func GetSlowRequests(ctx context.Context, lg *mid.Logging, lgr logger.Logger) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		respond.New(writer, lgr).WriteObjects(ctx, map[string]any{"slow_requests": lg.SlowCounts()})
+	}
+}
+
 func (svr *Server) work(ctx context.Context, httpServer *http.Server) {
 
 	svr.Logger.Info(ctx, "listening", "address", svr.Addr)
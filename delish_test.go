@@ -10,6 +10,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/clarktrimble/delish/mid"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -85,6 +87,22 @@ var _ = Describe("Delish", func() {
 					Expect(svr.Timeout).To(Equal(33 * time.Second))
 				})
 			})
+
+			When("logging options are given", func() {
+				BeforeEach(func() {
+					ctx = context.Background()
+				})
+
+				JustBeforeEach(func() {
+					svr = cfg.NewWithLog(ctx, handler, lgr, mid.WithSkipBody(), mid.WithRedactHeaders("Cookie"))
+				})
+
+				It("creates a well formed server", func() {
+					Expect(svr.Addr).To(Equal(":8083"))
+					Expect(svr.Handler).ToNot(BeNil())
+					Expect(svr.Logger).To(Equal(lgr))
+				})
+			})
 		})
 	})
 
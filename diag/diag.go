@@ -0,0 +1,328 @@
+// Package diag writes a bundle of diagnostics for a running process.
+package diag
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	redacted string = "--redacted--"
+)
+
+var (
+	defaultRedact = []string{"password", "secret", "token", "credential"}
+)
+
+// Config is the diagnostics configuration.
+type Config struct {
+	Dir         string        `json:"dir" desc:"directory in which to write bundles, disabled when blank"`
+	CpuDuration time.Duration `json:"cpu_duration" desc:"duration of cpu profile" default:"5s"`
+	Redact      []string      `json:"redact" desc:"config keys to redact, matched by substring"`
+}
+
+// Diag writes diagnostic bundles.
+type Diag struct {
+	Dir         string
+	CpuDuration time.Duration
+	Redact      []string
+	Objects     map[string]any
+	Logger      logger.Logger
+	started     time.Time
+	mu          sync.Mutex
+}
+
+// New creates a Diag from config.
+//
+// Objects are marshalled, redacted, and included in bundles as config.json.
+func (cfg *Config) New(objects map[string]any, lgr logger.Logger) *Diag {
+
+	redact := cfg.Redact
+	if len(redact) == 0 {
+		redact = defaultRedact
+	}
+
+	return &Diag{
+		Dir:         cfg.Dir,
+		CpuDuration: cfg.CpuDuration,
+		Redact:      redact,
+		Objects:     objects,
+		Logger:      lgr,
+		started:     time.Now(),
+	}
+}
+
+// Handle writes a bundle, logging the outcome.
+func (dg *Diag) Handle(ctx context.Context) {
+
+	dg.Logger.Info(ctx, "writing diagnostics bundle", "cpu_duration", dg.CpuDuration)
+
+	path, err := dg.Bundle(ctx)
+	if err != nil {
+		dg.Logger.Error(ctx, "failed to write diagnostics bundle", err)
+		return
+	}
+
+	dg.Logger.Info(ctx, "diagnostics bundle written", "path", path)
+}
+
+// Bundle writes a tar.gz of diagnostics to Dir, returning its path.
+//
+// Included are goroutine dump, heap and cpu profiles, redacted config,
+// build info, and runtime stats.
+// Only one bundle is written at a time.
+func (dg *Diag) Bundle(ctx context.Context) (path string, err error) {
+
+	if !dg.mu.TryLock() {
+		err = errors.Errorf("diagnostics bundle already in progress")
+		return
+	}
+	defer dg.mu.Unlock()
+
+	files, err := dg.collect(ctx)
+	if err != nil {
+		return
+	}
+
+	name := fmt.Sprintf("diag-%d-%s.tar.gz", os.Getpid(), time.Now().UTC().Format("20060102T150405.000Z"))
+	path = filepath.Join(dg.Dir, name)
+
+	err = writeBundle(path, files)
+	return
+}
+
+// unexported
+
+type file struct {
+	name string
+	data []byte
+}
+
+func (dg *Diag) collect(ctx context.Context) (files []file, err error) {
+
+	collectors := []struct {
+		name    string
+		collect func(ctx context.Context) ([]byte, error)
+	}{
+		{"goroutines.txt", goroutines},
+		{"heap.pprof", heap},
+		{"cpu.pprof", dg.cpu},
+		{"config.json", dg.config},
+		{"build.txt", build},
+		{"runtime.json", dg.stats},
+	}
+
+	for _, clt := range collectors {
+
+		var data []byte
+		data, err = clt.collect(ctx)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to collect %s", clt.name)
+			return
+		}
+
+		files = append(files, file{name: clt.name, data: data})
+	}
+
+	return
+}
+
+func goroutines(_ context.Context) (data []byte, err error) {
+
+	buf := &bytes.Buffer{}
+	err = pprof.Lookup("goroutine").WriteTo(buf, 2)
+	data = buf.Bytes()
+	return
+}
+
+func heap(_ context.Context) (data []byte, err error) {
+
+	runtime.GC()
+
+	buf := &bytes.Buffer{}
+	err = pprof.Lookup("heap").WriteTo(buf, 0)
+	data = buf.Bytes()
+	return
+}
+
+func (dg *Diag) cpu(ctx context.Context) (data []byte, err error) {
+
+	buf := &bytes.Buffer{}
+	err = pprof.StartCPUProfile(buf)
+	if err != nil {
+		return
+	}
+
+	timer := time.NewTimer(dg.CpuDuration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	pprof.StopCPUProfile()
+	data = buf.Bytes()
+	return
+}
+
+func (dg *Diag) config(_ context.Context) (data []byte, err error) {
+
+	// round trip through json to get at fields as served by ObjHandler
+
+	data, err = json.Marshal(dg.Objects)
+	if err != nil {
+		return
+	}
+
+	var generic any
+	err = json.Unmarshal(data, &generic)
+	if err != nil {
+		return
+	}
+
+	data, err = json.MarshalIndent(dg.redact(generic), "", "  ")
+	return
+}
+
+func (dg *Diag) redact(val any) any {
+
+	switch typed := val.(type) {
+	case map[string]any:
+		for key, inner := range typed {
+			if dg.sensitive(key) {
+				typed[key] = redacted
+				continue
+			}
+			typed[key] = dg.redact(inner)
+		}
+	case []any:
+		for i, inner := range typed {
+			typed[i] = dg.redact(inner)
+		}
+	}
+
+	return val
+}
+
+func (dg *Diag) sensitive(key string) bool {
+
+	key = strings.ToLower(key)
+	for _, sub := range dg.Redact {
+		if strings.Contains(key, strings.ToLower(sub)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func build(_ context.Context) (data []byte, err error) {
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		data = []byte("build info not available\n")
+		return
+	}
+
+	data = []byte(info.String())
+	return
+}
+
+func (dg *Diag) stats(_ context.Context) (data []byte, err error) {
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	data, err = json.MarshalIndent(map[string]any{
+		"go_version": runtime.Version(),
+		"goos":       runtime.GOOS,
+		"goarch":     runtime.GOARCH,
+		"num_cpu":    runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"goroutines": runtime.NumGoroutine(),
+		"uptime":     time.Since(dg.started).String(),
+		"memstats":   mem,
+	}, "", "  ")
+	return
+}
+
+func writeBundle(path string, files []file) (err error) {
+
+	// write to temp and rename so a partial bundle is never seen
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".diag-*")
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create bundle")
+		return
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after rename
+
+	err = writeTarGz(tmp, files)
+	if err != nil {
+		tmp.Close()
+		return
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to close bundle")
+		return
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	err = errors.Wrapf(err, "failed to rename bundle")
+	return
+}
+
+func writeTarGz(out *os.File, files []file) (err error) {
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for _, fl := range files {
+
+		err = tw.WriteHeader(&tar.Header{
+			Name:    fl.name,
+			Mode:    0644,
+			Size:    int64(len(fl.data)),
+			ModTime: now,
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed to write header for: %s", fl.name)
+			return
+		}
+
+		_, err = tw.Write(fl.data)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to write: %s", fl.name)
+			return
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to close tar")
+		return
+	}
+
+	err = gz.Close()
+	err = errors.Wrapf(err, "failed to close gzip")
+	return
+}
@@ -0,0 +1,151 @@
+package diag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate moq -pkg diag -out mock_test.go ../logger Logger
+
+func TestDiag(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diag Suite")
+}
+
+var _ = Describe("Diag", func() {
+	var (
+		ctx context.Context
+		lgr *LoggerMock
+		dg  *Diag
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+
+		cfg := &Config{
+			Dir:         GinkgoT().TempDir(),
+			CpuDuration: 9 * time.Millisecond,
+		}
+
+		dg = cfg.New(map[string]any{
+			"config": map[string]any{
+				"server":  map[string]any{"port": 8088},
+				"db":      map[string]any{"Password": "this-is-secret"},
+				"tokens":  []string{"a", "b"},
+				"api_key": "not-redacted-by-default",
+			},
+		}, lgr)
+	})
+
+	Describe("writing a bundle", func() {
+		var (
+			path string
+			err  error
+		)
+
+		JustBeforeEach(func() {
+			path, err = dg.Bundle(ctx)
+		})
+
+		When("all is well", func() {
+			It("writes a tar.gz with diagnostics and redacted config", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(filepath.Dir(path)).To(Equal(dg.Dir))
+
+				files := untar(path)
+				Expect(files).To(HaveKey("goroutines.txt"))
+				Expect(files).To(HaveKey("heap.pprof"))
+				Expect(files).To(HaveKey("cpu.pprof"))
+				Expect(files).To(HaveKey("build.txt"))
+				Expect(files["runtime.json"]).To(ContainSubstring(`"goroutines":`))
+				Expect(files["config.json"]).To(MatchJSON(`{"config":{
+					"server":{"port":8088},
+					"db":{"Password":"--redacted--"},
+					"tokens":"--redacted--",
+					"api_key":"not-redacted-by-default"
+				}}`))
+
+				entries, err := os.ReadDir(dg.Dir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+			})
+		})
+
+		When("a bundle is already in progress", func() {
+			BeforeEach(func() {
+				dg.mu.Lock()
+				DeferCleanup(dg.mu.Unlock)
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("already in progress")))
+			})
+		})
+
+		When("the dir does not exist", func() {
+			BeforeEach(func() {
+				dg.Dir = filepath.Join(dg.Dir, "nonesuch")
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to create bundle")))
+			})
+		})
+	})
+
+	Describe("handling a signal", func() {
+
+		JustBeforeEach(func() {
+			dg.Handle(ctx)
+		})
+
+		When("all is well", func() {
+			It("logs the bundle path", func() {
+				ic := lgr.InfoCalls()
+				Expect(ic).To(HaveLen(2))
+				Expect(ic[1].Msg).To(Equal("diagnostics bundle written"))
+				Expect(ic[1].Kv[0]).To(Equal("path"))
+				Expect(ic[1].Kv[1]).To(BeAnExistingFile())
+			})
+		})
+	})
+})
+
+func untar(path string) (files map[string]string) {
+
+	fh, err := os.Open(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer fh.Close()
+
+	gz, err := gzip.NewReader(fh)
+	Expect(err).ToNot(HaveOccurred())
+
+	files = map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).ToNot(HaveOccurred())
+
+		data, err := io.ReadAll(tr)
+		Expect(err).ToNot(HaveOccurred())
+		files[hdr.Name] = string(data)
+	}
+
+	return
+}
@@ -55,6 +55,22 @@ func (ml *MinLog) GetLevel() string {
 	return "not_implemented"
 }
 
+// Enabled is always true as all levels are logged.
+func (ml *MinLog) Enabled(ctx context.Context, level string) bool {
+	return true
+}
+
+// Fields gets fields added to ctx.
+func (ml *MinLog) Fields(ctx context.Context) map[string]any {
+
+	flds := map[string]any{}
+	for key, val := range getFields(ctx) {
+		flds[key] = val
+	}
+
+	return flds
+}
+
 // unexported
 
 type ctxKey struct{}
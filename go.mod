@@ -8,6 +8,7 @@ require (
 	github.com/onsi/ginkgo/v2 v2.11.0
 	github.com/onsi/gomega v1.27.8
 	github.com/pkg/errors v0.9.1
+	golang.org/x/crypto v0.40.0
 )
 
 require (
@@ -4,24 +4,60 @@ package graceful
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
+	"github.com/clarktrimble/delish/diag"
 	"github.com/clarktrimble/delish/logger"
+	"github.com/pkg/errors"
 )
 
 var (
-	stop     []os.Signal = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt}
-	graceful *Graceful
+	stop      []os.Signal = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt}
+	graceful  *Graceful
+	observers []Observer
 )
 
+// Lifecycle events, as given to an Observer.
+const (
+	StartingUp      string = "starting_up"
+	RefusingToStart string = "refusing_to_start"
+	ShuttingDown    string = "shutting_down"
+)
+
+// Observer is notified of lifecycle events, as by a metrics sink.
+type Observer interface {
+	Event(ctx context.Context, name string)
+}
+
+// Observe adds obs to be notified of lifecycle events.
+//
+// Call ahead of Initialize to be notified of starting up.
+// Refusing to start is notified just before the error is returned, so deliver it at once.
+// There is no event on stopping, as goroutines such as a sink have finished by then.
+func Observe(obs Observer) {
+
+	observers = append(observers, obs)
+}
+
+// Config is optional configuration for graceful.
+type Config struct {
+	PidFile  string       `json:"pid_file" desc:"path of pid file to write, none when blank"`
+	LockFile string       `json:"lock_file" desc:"path of file to lock exclusively, none when blank"`
+	Diag     *diag.Config `json:"diag"`
+}
+
 // Graceful is for a graceful shutdown.
 type Graceful struct {
 	WaitGroup *sync.WaitGroup
 	Cancel    context.CancelFunc
 	Logger    logger.Logger
+	PidFile   string
+	Diag      *diag.Diag
+	lock      *os.File
 }
 
 // Initialize sets up the one and only graceful; singelton!
@@ -33,6 +69,7 @@ type Graceful struct {
 func Initialize(ctx context.Context, wg *sync.WaitGroup, lgr logger.Logger, kv ...any) context.Context {
 
 	lgr.Info(ctx, "starting up", kv...)
+	notify(ctx, StartingUp)
 	ctx, cancel := context.WithCancel(ctx)
 
 	graceful = &Graceful{
@@ -44,16 +81,65 @@ func Initialize(ctx context.Context, wg *sync.WaitGroup, lgr logger.Logger, kv .
 	return ctx
 }
 
+// Initialize sets up graceful as above, additionally locking and writing a pid file per config.
+//
+// An error is logged and returned when the lock is held by another instance,
+// in which case the caller is expected to refuse to start.
+// The pid file is removed, and lock released, by Wait.
+//
+// When a diag dir is configured, Wait writes a diagnostics bundle on SIGUSR1
+// including kv pairs as config.
+func (cfg *Config) Initialize(ctx context.Context, wg *sync.WaitGroup, lgr logger.Logger, kv ...any) (context.Context, error) {
+
+	lock, err := lockFile(cfg.LockFile)
+	if err != nil {
+		lgr.Error(ctx, "refusing to start", err)
+		notify(ctx, RefusingToStart)
+		return ctx, err
+	}
+
+	err = writePid(cfg.PidFile)
+	if err != nil {
+		unlock(lock)
+		lgr.Error(ctx, "refusing to start", err)
+		notify(ctx, RefusingToStart)
+		return ctx, err
+	}
+
+	ctx = Initialize(ctx, wg, lgr, kv...)
+	graceful.PidFile = cfg.PidFile
+	graceful.lock = lock
+
+	if cfg.Diag != nil && cfg.Diag.Dir != "" {
+		graceful.Diag = cfg.Diag.New(objects(kv), lgr)
+	}
+
+	return ctx, nil
+}
+
 // Wait blocks until interrupted, cancels ctx, waits for group, and exits.
+//
+// Diagnostic signals are handled in the background, carrying on with the wait.
 func Wait(ctx context.Context) {
 
 	// wait for interrupt
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, stop...)
-	<-sigChan
+	if graceful.Diag != nil {
+		signal.Notify(sigChan, diagnose...)
+	}
+
+	for sig := range sigChan {
+		if !isDiagnose(sig) {
+			break
+		}
+		go graceful.Diag.Handle(ctx)
+	}
+	signal.Stop(sigChan)
 
 	graceful.Logger.Info(ctx, "shutting down")
+	notify(ctx, ShuttingDown)
 
 	// when cancel is called other routines blocking on ctx.Done can proceed with shutdown
 	// wait for them to finish via the wait group ... and we're done!
@@ -61,5 +147,69 @@ func Wait(ctx context.Context) {
 	graceful.Cancel()
 	graceful.WaitGroup.Wait()
 
+	graceful.release(ctx)
 	graceful.Logger.Info(ctx, "stopped")
 }
+
+// unexported
+
+func notify(ctx context.Context, event string) {
+
+	for _, obs := range observers {
+		obs.Event(ctx, event)
+	}
+}
+
+func (gf *Graceful) release(ctx context.Context) {
+
+	if gf.PidFile != "" {
+		err := os.Remove(gf.PidFile)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to remove pid file")
+			gf.Logger.Error(ctx, "failed to release", err)
+		}
+	}
+
+	unlock(gf.lock)
+	gf.lock = nil
+}
+
+func isDiagnose(sig os.Signal) bool {
+
+	for _, diagSig := range diagnose {
+		if sig == diagSig {
+			return true
+		}
+	}
+
+	return false
+}
+
+func objects(kv []any) (objs map[string]any) {
+
+	objs = map[string]any{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		objs[fmt.Sprintf("%s", kv[i])] = kv[i+1]
+	}
+
+	return
+}
+
+func writePid(path string) (err error) {
+
+	if path == "" {
+		return
+	}
+
+	err = os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644) //nolint:gosec // pid is not secret
+	err = errors.Wrapf(err, "failed to write pid file")
+	return
+}
+
+func unlock(lock *os.File) {
+
+	if lock != nil {
+		// closing releases the lock
+		_ = lock.Close()
+	}
+}
@@ -2,12 +2,16 @@ package graceful
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/clarktrimble/delish/diag"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -23,6 +27,7 @@ var _ = Describe("Graceful", func() {
 	var (
 		ctx context.Context
 		lgr *LoggerMock
+		obs *testObserver
 		wg  sync.WaitGroup
 	)
 
@@ -31,6 +36,10 @@ var _ = Describe("Graceful", func() {
 			InfoFunc: func(ctx context.Context, msg string, kv ...any) {},
 		}
 
+		obs = &testObserver{}
+		Observe(obs)
+		DeferCleanup(func() { observers = nil })
+
 		ctx = Initialize(context.Background(), &wg, lgr)
 	})
 
@@ -42,6 +51,91 @@ var _ = Describe("Graceful", func() {
 				Expect(graceful.Cancel).ToNot(BeNil())
 				Expect(graceful.Logger).ToNot(BeNil())
 			})
+
+			It("notifies observers", func() {
+				Expect(obs.events).To(Equal([]string{StartingUp}))
+			})
+		})
+	})
+
+	Describe("initializing with config", func() {
+		var (
+			cfg *Config
+			dir string
+			err error
+		)
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			cfg = &Config{
+				PidFile:  filepath.Join(dir, "test.pid"),
+				LockFile: filepath.Join(dir, "test.lock"),
+			}
+			lgr.ErrorFunc = func(ctx context.Context, msg string, err error, kv ...any) {}
+		})
+
+		JustBeforeEach(func() {
+			_, err = cfg.Initialize(context.Background(), &wg, lgr)
+		})
+
+		AfterEach(func() {
+			graceful.release(context.Background())
+		})
+
+		When("all is well", func() {
+			It("writes the pid file and holds the lock", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(graceful.lock).ToNot(BeNil())
+
+				data, err := os.ReadFile(cfg.PidFile)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(fmt.Sprintf("%d\n", os.Getpid())))
+			})
+
+			It("removes the pid file on release", func() {
+				graceful.release(context.Background())
+
+				Expect(graceful.lock).To(BeNil())
+				Expect(cfg.PidFile).ToNot(BeAnExistingFile())
+			})
+		})
+
+		When("another instance holds the lock", func() {
+			var (
+				other *os.File
+			)
+
+			BeforeEach(func() {
+				other, err = lockFile(cfg.LockFile)
+				Expect(err).ToNot(HaveOccurred())
+				DeferCleanup(other.Close)
+			})
+
+			It("logs and returns an error and does not write the pid file", func() {
+				Expect(err).To(MatchError(ContainSubstring("another instance holds lock on")))
+				Expect(cfg.PidFile).ToNot(BeAnExistingFile())
+
+				ec := lgr.ErrorCalls()
+				Expect(ec).To(HaveLen(1))
+				Expect(ec[0].Msg).To(Equal("refusing to start"))
+
+				Expect(obs.events).To(Equal([]string{StartingUp, RefusingToStart}))
+			})
+		})
+
+		When("the pid file cannot be written", func() {
+			BeforeEach(func() {
+				cfg.PidFile = filepath.Join(dir, "nonesuch", "test.pid")
+			})
+
+			It("logs and returns an error and releases the lock", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to write pid file")))
+				Expect(lgr.ErrorCalls()).To(HaveLen(1))
+
+				other, err := lockFile(cfg.LockFile)
+				Expect(err).ToNot(HaveOccurred())
+				other.Close()
+			})
 		})
 	})
 
@@ -80,6 +174,55 @@ var _ = Describe("Graceful", func() {
 				Expect(ic()[3].Msg).To(Equal("shutting down testSvc")) // <- triggered by cancel
 				Expect(ic()[4].Msg).To(Equal("testSvc stopped"))       //
 				Expect(ic()[5].Msg).To(Equal("stopped"))               // <- waitgroup'ed for this one!
+
+				Expect(obs.events).To(Equal([]string{StartingUp, ShuttingDown}))
+			})
+		})
+
+		When("diagnostics are configured and requested", func() {
+			var (
+				dir string
+			)
+
+			BeforeEach(func() {
+				dir = GinkgoT().TempDir()
+				cfg := &Config{
+					Diag: &diag.Config{Dir: dir, CpuDuration: 9 * time.Millisecond},
+				}
+
+				var err error
+				ctx, err = cfg.Initialize(context.Background(), &wg, lgr, "config", cfg)
+				Expect(err).ToNot(HaveOccurred())
+
+				// signal diagnose, wait for bundle, then signal shutdown
+
+				go func() {
+					defer GinkgoRecover()
+
+					proc, err := os.FindProcess(os.Getpid())
+					Expect(err).ToNot(HaveOccurred())
+					err = proc.Signal(syscall.SIGUSR1)
+					Expect(err).ToNot(HaveOccurred())
+
+					Eventually(lgr.InfoCalls).Should(HaveLen(4))
+
+					err = proc.Signal(syscall.SIGQUIT)
+					Expect(err).ToNot(HaveOccurred())
+				}()
+
+				Wait(ctx)
+			})
+
+			It("writes a bundle and carries on until interrupted", func() {
+				ic := lgr.InfoCalls()
+				Expect(ic).To(HaveLen(6))
+				Expect(ic[1].Msg).To(Equal("starting up"))
+				Expect(ic[2].Msg).To(Equal("writing diagnostics bundle"))
+				Expect(ic[3].Msg).To(Equal("diagnostics bundle written"))
+				Expect(ic[4].Msg).To(Equal("shutting down"))
+				Expect(ic[5].Msg).To(Equal("stopped"))
+
+				Expect(filepath.Glob(filepath.Join(dir, "diag-*.tar.gz"))).To(HaveLen(1))
 			})
 		})
 	})
@@ -116,3 +259,11 @@ func (svc *testSvc) Start(ctx context.Context, wg *sync.WaitGroup, lgr *LoggerMo
 
 	lgr.Info(ctx, "testSvc stopped")
 }
+
+type testObserver struct {
+	events []string
+}
+
+func (to *testObserver) Event(ctx context.Context, name string) {
+	to.events = append(to.events, name)
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package graceful
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	diagnose []os.Signal
+)
+
+// lockFile is not supported off of unix.
+func lockFile(path string) (lock *os.File, err error) {
+
+	if path == "" {
+		return
+	}
+
+	err = errors.Errorf("file locking is not supported on this platform")
+	return
+}
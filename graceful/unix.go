@@ -0,0 +1,42 @@
+//go:build unix
+
+package graceful
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	diagnose []os.Signal = []os.Signal{syscall.SIGUSR1}
+)
+
+// lockFile opens and exclusively locks path, failing when already held.
+func lockFile(path string) (lock *os.File, err error) {
+
+	if path == "" {
+		return
+	}
+
+	lock, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644) //nolint:gosec // lock is not secret
+	if err != nil {
+		err = errors.Wrapf(err, "failed to open lock file")
+		return
+	}
+
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = lock.Close()
+		lock = nil
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			err = errors.Errorf("another instance holds lock on: %s", path)
+			return
+		}
+		err = errors.Wrapf(err, "failed to lock: %s", path)
+	}
+
+	return
+}
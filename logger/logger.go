@@ -12,3 +12,39 @@ type Logger interface {
 	SetLevel(ctx context.Context, level string) (err error)
 	GetLevel() string
 }
+
+// Enabler is optionally implemented by a Logger to report whether a level would be logged.
+//
+// Middleware can then skip the work of gathering fields that would be dropped.
+type Enabler interface {
+	Enabled(ctx context.Context, level string) bool
+}
+
+// Enabled reports whether lgr logs at level, assuming so when lgr is not an Enabler.
+func Enabled(ctx context.Context, lgr Logger, level string) bool {
+
+	enabler, ok := lgr.(Enabler)
+	if !ok {
+		return true
+	}
+
+	return enabler.Enabled(ctx, level)
+}
+
+// Fielder is optionally implemented by a Logger to get the fields added to ctx by WithFields.
+//
+// Metrics sinks can then tag with fields such as app_id.
+type Fielder interface {
+	Fields(ctx context.Context) map[string]any
+}
+
+// Fields gets the fields in ctx, nil when lgr is not a Fielder.
+func Fields(ctx context.Context, lgr Logger) map[string]any {
+
+	fielder, ok := lgr.(Fielder)
+	if !ok {
+		return nil
+	}
+
+	return fielder.Fields(ctx)
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// histogram counts observations per bucket, with bounds ascending.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (hst *histogram) observe(value float64) {
+
+	// first bound at or above value, as buckets are less than or equal
+	idx := sort.SearchFloat64s(hst.bounds, value)
+	if idx < len(hst.counts) {
+		hst.counts[idx]++
+	}
+
+	hst.sum += value
+	hst.count++
+}
+
+// write writes request metrics, with series sorted for a stable exposition.
+func (mtr *Metrics) write(buf *bytes.Buffer) {
+
+	mtr.mu.Lock()
+	defer mtr.mu.Unlock()
+
+	keys := make([]labels, 0, len(mtr.series))
+	for lbls := range mtr.series {
+		keys = append(keys, lbls)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	name := mtr.name("http_requests_total")
+	family(buf, name, "counter", "Requests served, by method, route, and status class.")
+	for _, lbls := range keys {
+		sample(buf, name, lbls.String(), float64(mtr.series[lbls].latency.count))
+	}
+
+	name = mtr.name("http_request_duration_seconds")
+	family(buf, name, "histogram", "Request latency in seconds, by method, route, and status class.")
+	for _, lbls := range keys {
+		mtr.series[lbls].latency.write(buf, name, lbls)
+	}
+
+	name = mtr.name("http_response_size_bytes")
+	family(buf, name, "histogram", "Response body size in bytes, by method, route, and status class.")
+	for _, lbls := range keys {
+		mtr.series[lbls].size.write(buf, name, lbls)
+	}
+
+	flying := make([]string, 0, len(mtr.inFlight))
+	for method := range mtr.inFlight {
+		flying = append(flying, method)
+	}
+	sort.Strings(flying)
+
+	name = mtr.name("http_requests_in_flight")
+	family(buf, name, "gauge", "Requests being served, by method.")
+	for _, method := range flying {
+		sample(buf, name, labelString("method", method), float64(mtr.inFlight[method]))
+	}
+}
+
+func (mtr *Metrics) name(base string) string {
+
+	if mtr.Namespace == "" {
+		return base
+	}
+	return mtr.Namespace + "_" + base
+}
+
+func (hst *histogram) write(buf *bytes.Buffer, name string, lbls labels) {
+
+	var cumulative uint64
+	for i, bound := range hst.bounds {
+		cumulative += hst.counts[i]
+		sample(buf, name+"_bucket", lbls.with("le", formatFloat(bound)), float64(cumulative))
+	}
+	sample(buf, name+"_bucket", lbls.with("le", "+Inf"), float64(hst.count))
+
+	sample(buf, name+"_sum", lbls.String(), hst.sum)
+	sample(buf, name+"_count", lbls.String(), float64(hst.count))
+}
+
+func writeRuntime(buf *bytes.Buffer) {
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count())},
+		{"go_memstats_alloc_bytes", "Bytes allocated and still in use.", float64(stats.Alloc)},
+		{"go_memstats_sys_bytes", "Bytes obtained from the system.", float64(stats.Sys)},
+		{"go_memstats_heap_inuse_bytes", "Bytes in in-use spans.", float64(stats.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", float64(stats.HeapObjects)},
+		{"go_memstats_last_gc_time_seconds", "Seconds since the epoch of the last garbage collection.", float64(stats.LastGC) / 1e9},
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"go_memstats_alloc_bytes_total", "Bytes allocated, even if freed.", float64(stats.TotalAlloc)},
+		{"go_gc_cycles_total", "Completed garbage collection cycles.", float64(stats.NumGC)},
+		{"go_gc_pause_seconds_total", "Garbage collection pause time in seconds.", float64(stats.PauseTotalNs) / 1e9},
+	}
+
+	family(buf, "go_info", "gauge", "Information about the Go environment.")
+	sample(buf, "go_info", labelString("version", runtime.Version()), 1)
+
+	for _, gauge := range gauges {
+		family(buf, gauge.name, "gauge", gauge.help)
+		sample(buf, gauge.name, "", gauge.value)
+	}
+	for _, counter := range counters {
+		family(buf, counter.name, "counter", counter.help)
+		sample(buf, counter.name, "", counter.value)
+	}
+}
+
+// exposition format primitives
+
+func family(buf *bytes.Buffer, name, kind, help string) {
+
+	buf.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func sample(buf *bytes.Buffer, name, lbls string, value float64) {
+
+	buf.WriteString(name + lbls + " " + formatFloat(value) + "\n")
+}
+
+func (lbls labels) String() string {
+
+	return labelString("method", lbls.method, "route", lbls.route, "status", lbls.class)
+}
+
+func (lbls labels) with(name, value string) string {
+
+	return labelString("method", lbls.method, "route", lbls.route, "status", lbls.class, name, value)
+}
+
+// labelString formats name, value pairs as {name="value",..}, blank when none.
+func labelString(pairs ...string) string {
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+valueEscaper.Replace(pairs[i+1])+`"`)
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func formatFloat(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,197 @@
+// Package metrics provides request and Go runtime metrics in Prometheus text exposition format,
+// without a client library.
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/delish/mid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContentType is that of the text exposition format.
+	ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+	unmatched   string = "unmatched"
+	other       string = "other"
+)
+
+var (
+	// DefaultBuckets are latency histogram bounds in seconds, as with Prometheus client defaults.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are response size histogram bounds in bytes.
+	DefaultSizeBuckets = []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7}
+
+	methods = map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+		http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+		http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+	}
+)
+
+// Config is the metrics configuration.
+type Config struct {
+	Namespace   string    `json:"namespace" desc:"prefix for request metric names, such as api"`
+	Buckets     []float64 `json:"buckets" desc:"latency histogram bounds in seconds"`
+	SizeBuckets []float64 `json:"size_buckets" desc:"response size histogram bounds in bytes"`
+}
+
+// Metrics keeps request metrics, labeled by method, route pattern, and status class.
+//
+// Routes are the pattern matched by http.ServeMux, or "unmatched",
+// and methods other than the standard ones are labeled "other", keeping cardinality bounded.
+// In-flight requests are labeled by method alone, as route and status are yet unknown.
+type Metrics struct {
+	Namespace   string
+	Buckets     []float64
+	SizeBuckets []float64
+	mu          sync.Mutex
+	series      map[labels]*series
+	inFlight    map[string]int64
+}
+
+// New creates Metrics from Config.
+func (cfg *Config) New() *Metrics {
+
+	mtr := &Metrics{
+		Namespace:   cfg.Namespace,
+		Buckets:     cfg.Buckets,
+		SizeBuckets: cfg.SizeBuckets,
+		series:      map[labels]*series{},
+		inFlight:    map[string]int64{},
+	}
+
+	mtr.Buckets = bounds(mtr.Buckets, DefaultBuckets)
+	mtr.SizeBuckets = bounds(mtr.SizeBuckets, DefaultSizeBuckets)
+
+	return mtr
+}
+
+// Measure is a middleware counting requests and observing latency and response size.
+//
+// Wrap the router directly, as the route pattern set by http.ServeMux is seen only
+// when the request is passed through as is.
+func (mtr *Metrics) Measure(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		method := methodOf(request)
+		mtr.track(method, 1)
+		defer mtr.track(method, -1)
+
+		start := time.Now()
+		str := mid.NewStreaming(writer)
+
+		next.ServeHTTP(str, request)
+
+		lbls := labels{
+			method: method,
+			route:  routeOf(request),
+			class:  statusClass(str.Status()),
+		}
+		mtr.observe(lbls, time.Since(start), str.Size())
+	}
+}
+
+// Handler serves metrics in text exposition format.
+func (mtr *Metrics) Handler() http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		writer.Header().Set("Content-Type", ContentType)
+		_, _ = mtr.WriteTo(writer)
+	}
+}
+
+// WriteTo writes request and Go runtime metrics to writer in text exposition format.
+func (mtr *Metrics) WriteTo(writer io.Writer) (count int64, err error) {
+
+	buf := &bytes.Buffer{}
+	mtr.write(buf)
+	writeRuntime(buf)
+
+	count, err = buf.WriteTo(writer)
+	err = errors.Wrapf(err, "failed to write metrics")
+	return
+}
+
+// unexported
+
+type labels struct {
+	method string
+	route  string
+	class  string
+}
+
+type series struct {
+	latency *histogram
+	size    *histogram
+}
+
+func (mtr *Metrics) track(method string, delta int64) {
+
+	mtr.mu.Lock()
+	defer mtr.mu.Unlock()
+
+	mtr.inFlight[method] += delta
+}
+
+func (mtr *Metrics) observe(lbls labels, elapsed time.Duration, size int) {
+
+	mtr.mu.Lock()
+	defer mtr.mu.Unlock()
+
+	srs, ok := mtr.series[lbls]
+	if !ok {
+		srs = &series{
+			latency: newHistogram(mtr.Buckets),
+			size:    newHistogram(mtr.SizeBuckets),
+		}
+		mtr.series[lbls] = srs
+	}
+
+	srs.latency.observe(elapsed.Seconds())
+	srs.size.observe(float64(size))
+}
+
+// bounds gets a sorted copy of given, or fallback when none.
+func bounds(given, fallback []float64) []float64 {
+
+	if len(given) == 0 {
+		return fallback
+	}
+
+	sorted := append([]float64{}, given...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+func methodOf(request *http.Request) string {
+
+	if methods[request.Method] {
+		return request.Method
+	}
+	return other
+}
+
+func routeOf(request *http.Request) string {
+
+	if request.Pattern != "" {
+		return request.Pattern
+	}
+	return unmatched
+}
+
+func statusClass(status int) string {
+
+	if status < 100 || status > 599 {
+		return other
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
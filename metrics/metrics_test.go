@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics Suite")
+}
+
+var _ = Describe("Metrics", func() {
+	var (
+		mtr     *Metrics
+		handler http.Handler
+		output  string
+	)
+
+	BeforeEach(func() {
+		mtr = (&Config{}).New()
+
+		rtr := http.NewServeMux()
+		rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {
+			_, err := writer.Write([]byte("ima pc"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+		rtr.HandleFunc("POST /items", func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusBadRequest)
+		})
+		rtr.HandleFunc("GET /in-flight", func(writer http.ResponseWriter, request *http.Request) {
+			output = scrape(mtr)
+		})
+
+		handler = mtr.Measure(rtr)
+	})
+
+	serve := func(method, path string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+
+	When("requests are served", func() {
+		BeforeEach(func() {
+			serve("GET", "/items/1")
+			serve("GET", "/items/2")
+			serve("POST", "/items")
+			serve("GET", "/nope")
+			serve("BREW", "/items/3")
+			output = scrape(mtr)
+		})
+
+		It("exposes valid text exposition format", func() {
+			Expect(checkExposition(output)).To(Succeed())
+		})
+
+		It("counts by method, route pattern, and status class", func() {
+			Expect(output).To(ContainSubstring("# TYPE http_requests_total counter\n"))
+			Expect(output).To(ContainSubstring(`http_requests_total{method="GET",route="GET /items/{id}",status="2xx"} 2` + "\n"))
+			Expect(output).To(ContainSubstring(`http_requests_total{method="POST",route="POST /items",status="4xx"} 1` + "\n"))
+			Expect(output).To(ContainSubstring(`http_requests_total{method="GET",route="unmatched",status="4xx"} 1` + "\n"))
+			Expect(output).To(ContainSubstring(`http_requests_total{method="other",route="unmatched",status="4xx"} 1` + "\n"))
+		})
+
+		It("observes latency and size in histograms", func() {
+			Expect(output).To(ContainSubstring("# TYPE http_request_duration_seconds histogram\n"))
+			Expect(output).To(ContainSubstring(`http_request_duration_seconds_bucket{method="GET",route="GET /items/{id}",status="2xx",le="+Inf"} 2` + "\n"))
+			Expect(output).To(ContainSubstring(`http_request_duration_seconds_count{method="GET",route="GET /items/{id}",status="2xx"} 2` + "\n"))
+
+			Expect(output).To(ContainSubstring("# TYPE http_response_size_bytes histogram\n"))
+			Expect(output).To(ContainSubstring(`http_response_size_bytes_bucket{method="GET",route="GET /items/{id}",status="2xx",le="100"} 2` + "\n"))
+			Expect(output).To(ContainSubstring(`http_response_size_bytes_sum{method="GET",route="GET /items/{id}",status="2xx"} 12` + "\n"))
+		})
+
+		It("includes go runtime metrics", func() {
+			Expect(output).To(MatchRegexp(`(?m)^go_goroutines \d+$`))
+			Expect(output).To(MatchRegexp(`(?m)^go_memstats_alloc_bytes \d+`))
+			Expect(output).To(MatchRegexp(`(?m)^go_info\{version="go[^"]+"\} 1$`))
+			Expect(output).To(ContainSubstring("# TYPE go_gc_cycles_total counter\n"))
+		})
+	})
+
+	When("a request is in flight", func() {
+		BeforeEach(func() {
+			serve("GET", "/in-flight")
+		})
+
+		It("is gauged by method", func() {
+			Expect(output).To(ContainSubstring("# TYPE http_requests_in_flight gauge\n"))
+			Expect(output).To(ContainSubstring(`http_requests_in_flight{method="GET"} 1` + "\n"))
+
+			Expect(scrape(mtr)).To(ContainSubstring(`http_requests_in_flight{method="GET"} 0` + "\n"))
+		})
+	})
+
+	When("configured with a namespace and buckets", func() {
+		BeforeEach(func() {
+			mtr = (&Config{Namespace: "api", Buckets: []float64{1, 0.5}, SizeBuckets: []float64{1}}).New()
+			handler = mtr.Measure(http.NotFoundHandler())
+
+			serve("GET", "/")
+			output = scrape(mtr)
+		})
+
+		It("prefixes request metrics and uses sorted buckets", func() {
+			Expect(checkExposition(output)).To(Succeed())
+			Expect(output).To(ContainSubstring(`api_http_requests_total{method="GET",route="unmatched",status="4xx"} 1` + "\n"))
+			Expect(output).To(MatchRegexp(`le="0.5"\} 1\n.*le="1"\} 1\n.*le="\+Inf"\} 1\n`))
+			Expect(output).To(ContainSubstring("\ngo_goroutines "))
+		})
+	})
+
+	Describe("serving metrics", func() {
+		It("responds with the exposition content type", func() {
+			recorder := httptest.NewRecorder()
+			mtr.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+			Expect(checkExposition(recorder.Body.String())).To(Succeed())
+		})
+	})
+
+	DescribeTable("formatting labels",
+		func(pairs []string, expected string) {
+			Expect(labelString(pairs...)).To(Equal(expected))
+		},
+		Entry("none", nil, ""),
+		Entry("plain", []string{"a", "b"}, `{a="b"}`),
+		Entry("escaped", []string{"a", "q\"b\\s\nn"}, `{a="q\"b\\s\nn"}`),
+	)
+
+	DescribeTable("checking exposition catches",
+		func(text, expected string) {
+			Expect(checkExposition(text)).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("no final newline", "# HELP a b\n# TYPE a gauge\na 1", "missing final newline"),
+		Entry("bad value", "# HELP a b\n# TYPE a gauge\na one\n", "bad value"),
+		Entry("unquoted label", "# HELP a b\n# TYPE a gauge\na{x=y} 1\n", "bad sample"),
+		Entry("stray sample", "# HELP a b\n# TYPE a gauge\nb 1\n", "outside its family"),
+		Entry("bad count", "# HELP h b\n# TYPE h histogram\nh_bucket{le=\"+Inf\"} 2\nh_sum 1\nh_count 3\n", "count disagrees"),
+	)
+})
+
+func scrape(mtr *Metrics) string {
+
+	builder := &strings.Builder{}
+	_, err := mtr.WriteTo(builder)
+	Expect(err).ToNot(HaveOccurred())
+
+	return builder.String()
+}
+
+var (
+	helpLine   = regexp.MustCompile(`^# HELP ([a-zA-Z_:][a-zA-Z0-9_:]*) .*$`)
+	typeLine   = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram|summary|untyped)$`)
+	labelPair  = `[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"`
+	sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{` + labelPair + `(?:,` + labelPair + `)*\})? (\S+)$`)
+	leLabel    = regexp.MustCompile(`,?le="([^"]+)"`)
+)
+
+// checkExposition checks text against the exposition format, and histograms for consistency.
+func checkExposition(text string) error {
+
+	if !strings.HasSuffix(text, "\n") {
+		return fmt.Errorf("missing final newline")
+	}
+
+	typed := map[string]string{}
+	family, kind := "", ""
+	buckets := map[string]float64{}
+	lastLe := map[string]float64{}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case helpLine.MatchString(line):
+			family = helpLine.FindStringSubmatch(line)[1]
+			continue
+		case typeLine.MatchString(line):
+			match := typeLine.FindStringSubmatch(line)
+			if match[1] != family {
+				return fmt.Errorf("type without help: %s", line)
+			}
+			if _, ok := typed[family]; ok {
+				return fmt.Errorf("family repeated: %s", family)
+			}
+			kind = match[2]
+			typed[family] = kind
+			continue
+		case strings.HasPrefix(line, "#"):
+			return fmt.Errorf("bad comment: %s", line)
+		}
+
+		match := sampleLine.FindStringSubmatch(line)
+		if match == nil {
+			return fmt.Errorf("bad sample: %s", line)
+		}
+		name, lbls := match[1], match[2]
+
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return fmt.Errorf("bad value: %s", line)
+		}
+
+		if kind != "histogram" {
+			if name != family {
+				return fmt.Errorf("sample outside its family: %s", line)
+			}
+			continue
+		}
+
+		// histogram buckets are cumulative and +Inf agrees with count
+		series := leLabel.ReplaceAllString(lbls, "")
+		switch name {
+		case family + "_bucket":
+			le, err := strconv.ParseFloat(leLabel.FindStringSubmatch(lbls)[1], 64)
+			if err != nil {
+				return fmt.Errorf("bad le: %s", line)
+			}
+			if prev, ok := lastLe[series]; ok && (le <= prev || value < buckets[series]) {
+				return fmt.Errorf("bucket out of order: %s", line)
+			}
+			lastLe[series], buckets[series] = le, value
+		case family + "_count":
+			if value != buckets[series] {
+				return fmt.Errorf("count disagrees with +Inf bucket: %s", line)
+			}
+			delete(lastLe, series)
+			delete(buckets, series)
+		case family + "_sum":
+		default:
+			return fmt.Errorf("sample outside its family: %s", line)
+		}
+	}
+
+	return scanner.Err()
+}
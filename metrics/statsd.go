@@ -0,0 +1,330 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/clarktrimble/delish/graceful"
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/mid"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxPacket int           = 1432
+	defaultFlush     time.Duration = time.Second
+	queueSize        int           = 4096
+)
+
+var (
+	defaultTagFields = []string{"app_id"}
+)
+
+// StatsdConfig is the statsd sink's configuration.
+type StatsdConfig struct {
+	Address   string        `json:"address" desc:"statsd agent udp address such as localhost:8125, nothing sent when blank"`
+	Prefix    string        `json:"prefix" desc:"metric name prefix such as api"`
+	Dog       bool          `json:"dog" desc:"send tags in dogstatsd format, otherwise tags are dropped"`
+	TagFields []string      `json:"tag_fields" desc:"ctx logging fields to tag with" default:"app_id"`
+	MaxPacket int           `json:"max_packet" desc:"largest packet in bytes" default:"1432"`
+	Interval  time.Duration `json:"interval" desc:"longest wait between packets" default:"1s"`
+}
+
+// Statsd sends metrics as StatsD or DogStatsD lines over udp.
+//
+// Lines are queued and batched into packets of at most MaxPacket bytes, sent at least every Interval,
+// and flushed on shutdown.
+// Lines are dropped, and counted, when the queue is full.
+// With Dog, lines are tagged with TagFields from the ctx logging fields, when the logger is a logger.Fielder,
+// along with those given.
+type Statsd struct {
+	Address   string
+	Prefix    string
+	Dog       bool
+	TagFields []string
+	MaxPacket int
+	Interval  time.Duration
+	Logger    logger.Logger
+	queue     chan string
+	dropped   atomic.Int64
+	mu        sync.Mutex
+	inFlight  map[string]int64
+}
+
+// New creates a Statsd from StatsdConfig.
+func (cfg *StatsdConfig) New(lgr logger.Logger) (sd *Statsd) {
+
+	sd = &Statsd{
+		Address:   cfg.Address,
+		Prefix:    cfg.Prefix,
+		Dog:       cfg.Dog,
+		TagFields: cfg.TagFields,
+		MaxPacket: cfg.MaxPacket,
+		Interval:  cfg.Interval,
+		Logger:    lgr,
+		queue:     make(chan string, queueSize),
+		inFlight:  map[string]int64{},
+	}
+
+	if sd.MaxPacket < 1 {
+		sd.MaxPacket = defaultMaxPacket
+	}
+	if sd.Interval <= 0 {
+		sd.Interval = defaultFlush
+	}
+	if sd.TagFields == nil {
+		sd.TagFields = defaultTagFields
+	}
+
+	return
+}
+
+// Start starts sending in the background, flushing what is queued when ctx is cancelled.
+//
+// Nothing is started without an Address.
+func (sd *Statsd) Start(ctx context.Context, wg *sync.WaitGroup) {
+
+	if sd.Address == "" {
+		return
+	}
+
+	conn, err := net.Dial("udp", sd.Address)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to dial statsd at: %s", sd.Address)
+		sd.Logger.Error(ctx, "failed to start statsd sink", err)
+		return
+	}
+
+	sd.Logger.Info(ctx, "starting statsd sink", "address", sd.Address)
+
+	wg.Add(1)
+	go sd.work(ctx, wg, conn)
+}
+
+// Dropped gets the count of lines dropped for want of room in the queue.
+func (sd *Statsd) Dropped() int64 {
+
+	return sd.dropped.Load()
+}
+
+// Count adds value to counter name, tagged with kv pairs.
+func (sd *Statsd) Count(ctx context.Context, name string, value int64, kv ...string) {
+
+	sd.send(ctx, name, strconv.FormatInt(value, 10), "c", kv)
+}
+
+// Gauge sets gauge name to value, tagged with kv pairs.
+func (sd *Statsd) Gauge(ctx context.Context, name string, value float64, kv ...string) {
+
+	sd.send(ctx, name, formatValue(value), "g", kv)
+}
+
+// Timing records elapsed in milliseconds as timer name, tagged with kv pairs.
+func (sd *Statsd) Timing(ctx context.Context, name string, elapsed time.Duration, kv ...string) {
+
+	sd.send(ctx, name, formatValue(float64(elapsed)/float64(time.Millisecond)), "ms", kv)
+}
+
+// Histogram records value in histogram name, tagged with kv pairs, as a timer when not Dog.
+func (sd *Statsd) Histogram(ctx context.Context, name string, value float64, kv ...string) {
+
+	kind := "ms"
+	if sd.Dog {
+		kind = "h"
+	}
+
+	sd.send(ctx, name, formatValue(value), kind, kv)
+}
+
+// Event counts a lifecycle event, implementing graceful.Observer.
+//
+// Refusing to start is sent at once, as the sink is not started by then.
+func (sd *Statsd) Event(ctx context.Context, name string) {
+
+	if name != graceful.RefusingToStart {
+		sd.Count(ctx, "lifecycle", 1, "event", name)
+		return
+	}
+
+	if sd.Address == "" {
+		return
+	}
+
+	conn, err := net.Dial("udp", sd.Address)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to dial statsd at: %s", sd.Address)
+		sd.Logger.Error(ctx, "failed to send metrics", err)
+		return
+	}
+	defer conn.Close()
+
+	sd.flush(ctx, conn, bytes.NewBufferString(sd.line(ctx, "lifecycle", "1", "c", []string{"event", name})))
+}
+
+// Measure is a middleware sending request metrics, labeled as with Metrics.Measure.
+//
+// Wrap the router directly, so the route pattern set by http.ServeMux is seen.
+func (sd *Statsd) Measure(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		ctx := request.Context()
+		method := methodOf(request)
+		sd.track(ctx, method, 1)
+		defer sd.track(ctx, method, -1)
+
+		start := time.Now()
+		str := mid.NewStreaming(writer)
+
+		next.ServeHTTP(str, request)
+
+		kv := []string{
+			"method", method,
+			"route", routeOf(request),
+			"status", statusClass(str.Status()),
+		}
+		sd.Count(ctx, "http.requests", 1, kv...)
+		sd.Timing(ctx, "http.request.duration", time.Since(start), kv...)
+		sd.Histogram(ctx, "http.response.size", float64(str.Size()), kv...)
+	}
+}
+
+// unexported
+
+func (sd *Statsd) track(ctx context.Context, method string, delta int64) {
+
+	sd.mu.Lock()
+	sd.inFlight[method] += delta
+	count := sd.inFlight[method]
+	sd.mu.Unlock()
+
+	sd.Gauge(ctx, "http.requests.in_flight", float64(count), "method", method)
+}
+
+func (sd *Statsd) send(ctx context.Context, name, value, kind string, kv []string) {
+
+	if sd.Address == "" {
+		return
+	}
+
+	select {
+	case sd.queue <- sd.line(ctx, name, value, kind, kv):
+	default:
+		sd.dropped.Add(1)
+	}
+}
+
+// line formats as with "prefix.name:value|kind|#tag:value,..", sanitizing names and tags.
+func (sd *Statsd) line(ctx context.Context, name, value, kind string, kv []string) string {
+
+	if sd.Prefix != "" {
+		name = sd.Prefix + "." + name
+	}
+
+	line := sanitize(name) + ":" + value + "|" + kind
+	if !sd.Dog {
+		return line
+	}
+
+	tags := []string{}
+	fields := logger.Fields(ctx, sd.Logger)
+	for _, key := range sd.TagFields {
+		val, ok := fields[key]
+		if ok {
+			tags = append(tags, sanitize(key)+":"+sanitize(fmt.Sprintf("%v", val)))
+		}
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		tags = append(tags, sanitize(kv[i])+":"+sanitize(kv[i+1]))
+	}
+
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
+
+func (sd *Statsd) work(ctx context.Context, wg *sync.WaitGroup, conn net.Conn) {
+
+	defer wg.Done()
+	defer conn.Close()
+
+	ticker := time.NewTicker(sd.Interval)
+	defer ticker.Stop()
+
+	packet := &bytes.Buffer{}
+	for {
+		select {
+		case line := <-sd.queue:
+			sd.add(ctx, conn, packet, line)
+		case <-ticker.C:
+			sd.flush(ctx, conn, packet)
+		case <-ctx.Done():
+			sd.drain(ctx, conn, packet)
+			sd.Logger.Info(ctx, "statsd sink stopped", "dropped", sd.Dropped())
+			return
+		}
+	}
+}
+
+func (sd *Statsd) drain(ctx context.Context, conn net.Conn, packet *bytes.Buffer) {
+
+	for {
+		select {
+		case line := <-sd.queue:
+			sd.add(ctx, conn, packet, line)
+		default:
+			sd.flush(ctx, conn, packet)
+			return
+		}
+	}
+}
+
+// add adds line to packet, sending first when it would not fit.
+func (sd *Statsd) add(ctx context.Context, conn net.Conn, packet *bytes.Buffer, line string) {
+
+	if packet.Len() > 0 && packet.Len()+1+len(line) > sd.MaxPacket {
+		sd.flush(ctx, conn, packet)
+	}
+
+	if packet.Len() > 0 {
+		packet.WriteByte('\n')
+	}
+	packet.WriteString(line)
+}
+
+func (sd *Statsd) flush(ctx context.Context, conn net.Conn, packet *bytes.Buffer) {
+
+	if packet.Len() == 0 {
+		return
+	}
+	defer packet.Reset()
+
+	_, err := conn.Write(packet.Bytes())
+	if err != nil {
+		err = errors.Wrapf(err, "failed to send to statsd at: %s", sd.Address)
+		sd.Logger.Error(ctx, "failed to send metrics", err)
+	}
+}
+
+var replacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+
+// sanitize replaces characters reserved by the line format.
+func sanitize(str string) string {
+
+	return replacer.Replace(str)
+}
+
+func formatValue(value float64) string {
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/delish/graceful"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate moq -pkg metrics -out mock_test.go ../logger Logger
+
+var _ = Describe("Statsd", func() {
+	var (
+		lgr    *LoggerMock
+		agent  net.PacketConn
+		cfg    *StatsdConfig
+		sd     *Statsd
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+		}
+
+		var err error
+		agent, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(agent.Close)
+
+		cfg = &StatsdConfig{
+			Address:  agent.LocalAddr().String(),
+			Prefix:   "api",
+			Dog:      true,
+			Interval: time.Hour,
+		}
+	})
+
+	JustBeforeEach(func() {
+		sd = cfg.New(&fielderMock{LoggerMock: lgr})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		sd.Start(ctx, &wg)
+	})
+
+	// stop cancels, waits for the flush, and gets packets received
+	stop := func() (packets []string) {
+		cancel()
+		wg.Wait()
+
+		buf := make([]byte, 65536)
+		for {
+			Expect(agent.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+			count, _, err := agent.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packets = append(packets, string(buf[:count]))
+		}
+	}
+
+	When("sending metrics of each kind", func() {
+		It("formats dogstatsd lines, tags them with ctx fields, and flushes on shutdown", func() {
+			tagged := withFields(context.Background(), "app_id", "api_demo", "run_id", "xyz")
+
+			sd.Count(tagged, "jobs", 3, "queue", "mail")
+			sd.Gauge(tagged, "depth", 1.5)
+			sd.Timing(tagged, "job.time", 1500*time.Microsecond)
+			sd.Histogram(context.Background(), "job.size", 42)
+			sd.Event(tagged, "shutting_down")
+
+			Expect(stop()).To(Equal([]string{strings.Join([]string{
+				"api.jobs:3|c|#app_id:api_demo,queue:mail",
+				"api.depth:1.5|g|#app_id:api_demo",
+				"api.job.time:1.5|ms|#app_id:api_demo",
+				"api.job.size:42|h",
+				"api.lifecycle:1|c|#app_id:api_demo,event:shutting_down",
+			}, "\n")}))
+
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(2))
+			Expect(ic[0].Msg).To(Equal("starting statsd sink"))
+			Expect(ic[1].Msg).To(Equal("statsd sink stopped"))
+		})
+	})
+
+	When("refusing to start", func() {
+		It("sends the event at once, as the sink is not started", func() {
+			cfg.New(lgr).Event(context.Background(), graceful.RefusingToStart)
+
+			Expect(stop()).To(Equal([]string{"api.lifecycle:1|c|#event:refusing_to_start"}))
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+		})
+	})
+
+	When("not dog", func() {
+		BeforeEach(func() {
+			cfg.Dog = false
+			cfg.Prefix = ""
+		})
+
+		It("drops tags and sends histograms as timers", func() {
+			sd.Count(context.Background(), "jobs|bad:name", 1, "queue", "mail")
+			sd.Histogram(context.Background(), "job.size", 42)
+
+			Expect(stop()).To(Equal([]string{"jobs_bad_name:1|c\njob.size:42|ms"}))
+		})
+	})
+
+	When("lines exceed a packet", func() {
+		BeforeEach(func() {
+			cfg.MaxPacket = 40
+		})
+
+		It("batches into packets of at most max", func() {
+			for range 5 {
+				sd.Count(context.Background(), "jobs", 1)
+			}
+
+			packets := stop()
+			Expect(packets).To(Equal([]string{
+				"api.jobs:1|c\napi.jobs:1|c\napi.jobs:1|c",
+				"api.jobs:1|c\napi.jobs:1|c",
+			}))
+			for _, packet := range packets {
+				Expect(len(packet)).To(BeNumerically("<=", 40))
+			}
+		})
+	})
+
+	When("the interval passes", func() {
+		BeforeEach(func() {
+			cfg.Interval = 10 * time.Millisecond
+		})
+
+		It("sends without waiting for shutdown", func() {
+			sd.Count(context.Background(), "jobs", 1)
+
+			buf := make([]byte, 1024)
+			Expect(agent.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			count, _, err := agent.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:count])).To(Equal("api.jobs:1|c"))
+
+			Expect(stop()).To(BeEmpty())
+		})
+	})
+
+	When("measuring requests", func() {
+		It("sends request metrics labeled by method, route, and status class", func() {
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {
+				_, err := writer.Write([]byte("ima pc"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			request := httptest.NewRequest("GET", "/items/42", nil)
+			request = request.WithContext(withFields(request.Context(), "app_id", "api_demo"))
+			sd.Measure(rtr).ServeHTTP(httptest.NewRecorder(), request)
+
+			packets := stop()
+			Expect(packets).To(HaveLen(1))
+
+			lines := strings.Split(packets[0], "\n")
+			Expect(lines).To(HaveLen(5))
+			Expect(lines[0]).To(Equal("api.http.requests.in_flight:1|g|#app_id:api_demo,method:GET"))
+			Expect(lines[1]).To(Equal("api.http.requests:1|c|#app_id:api_demo,method:GET,route:GET /items/{id},status:2xx"))
+			Expect(lines[2]).To(MatchRegexp(`^api\.http\.request\.duration:[0-9.]+\|ms\|#app_id:api_demo,method:GET,route:GET /items/\{id\},status:2xx$`))
+			Expect(lines[3]).To(Equal("api.http.response.size:6|h|#app_id:api_demo,method:GET,route:GET /items/{id},status:2xx"))
+			Expect(lines[4]).To(Equal("api.http.requests.in_flight:0|g|#app_id:api_demo,method:GET"))
+		})
+	})
+
+	When("no address is configured", func() {
+		BeforeEach(func() {
+			cfg.Address = ""
+		})
+
+		It("neither starts nor queues", func() {
+			sd.Count(context.Background(), "jobs", 1)
+
+			Expect(sd.queue).To(BeEmpty())
+			Expect(stop()).To(BeEmpty())
+			Expect(lgr.InfoCalls()).To(BeEmpty())
+		})
+	})
+
+	When("the queue is full", func() {
+		BeforeEach(func() {
+			cfg.Address = "127.0.0.1:0"
+		})
+
+		It("drops and counts", func() {
+			sd = cfg.New(lgr)
+			for range queueSize + 2 {
+				sd.Count(context.Background(), "jobs", 1)
+			}
+
+			Expect(sd.Dropped()).To(BeEquivalentTo(2))
+			stop()
+		})
+	})
+})
+
+type fieldsKey struct{}
+
+func withFields(ctx context.Context, kv ...any) context.Context {
+
+	fields := map[string]any{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[kv[i].(string)] = kv[i+1] //nolint:forcetypeassert // panic ok in test
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+type fielderMock struct {
+	*LoggerMock
+}
+
+func (fm *fielderMock) Fields(ctx context.Context) map[string]any {
+
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]any)
+	return fields
+}
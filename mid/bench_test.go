@@ -0,0 +1,89 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// compare allocations with trace enabled and not via:
+// go test -run xxx -bench . -benchmem ./mid
+
+func BenchmarkLogRequest(b *testing.B) {
+
+	for _, enabled := range []bool{true, false} {
+		b.Run(benchName(enabled), func(b *testing.B) {
+
+			handler := NewLogging(&nopLogger{enabled: enabled}).LogRequest(okHandler())
+			benchServe(b, handler)
+		})
+	}
+}
+
+func BenchmarkLogResponse(b *testing.B) {
+
+	for _, enabled := range []bool{true, false} {
+		b.Run(benchName(enabled), func(b *testing.B) {
+
+			handler := NewLogging(&nopLogger{enabled: enabled}).LogResponse(okHandler())
+			benchServe(b, handler)
+		})
+	}
+}
+
+func benchServe(b *testing.B, handler http.Handler) {
+
+	body := bytes.Repeat([]byte(`{"ima":"pc"}`), 99)
+	reader := bytes.NewReader(body)
+	request := httptest.NewRequest("POST", "/baltic/latvia/riga?ima=pc", nil)
+	request.Body = io.NopCloser(reader)
+	writer := &nopWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		reader.Reset(body)
+		handler.ServeHTTP(writer, request)
+	}
+}
+
+func benchName(enabled bool) string {
+
+	if enabled {
+		return "trace_enabled"
+	}
+	return "trace_disabled"
+}
+
+func okHandler() http.HandlerFunc {
+
+	body := bytes.Repeat([]byte(`{"ima":"pc"}`), 99)
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write(body)
+	}
+}
+
+type nopLogger struct {
+	enabled bool
+}
+
+func (nl *nopLogger) Info(ctx context.Context, msg string, kv ...any)             {}
+func (nl *nopLogger) Trace(ctx context.Context, msg string, kv ...any)            {}
+func (nl *nopLogger) Error(ctx context.Context, msg string, err error, kv ...any) {}
+func (nl *nopLogger) WithFields(ctx context.Context, kv ...any) context.Context   { return ctx }
+func (nl *nopLogger) SetLevel(ctx context.Context, level string) (err error)      { return }
+func (nl *nopLogger) GetLevel() string                                            { return "" }
+func (nl *nopLogger) Enabled(ctx context.Context, level string) bool              { return nl.enabled }
+
+type nopWriter struct {
+	header http.Header
+}
+
+func (nw *nopWriter) Header() http.Header            { return nw.header }
+func (nw *nopWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (nw *nopWriter) WriteHeader(status int)         {}
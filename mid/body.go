@@ -0,0 +1,295 @@
+package mid
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBodyLimit int = 4 << 10
+	// maxDecoded caps decompression when logging, in case of a bomb.
+	maxDecoded int = 1 << 20
+)
+
+// formatBody readies a body for logging per its content type.
+//
+// JSON is parsed so as to log structured, binary is summarized,
+// and text is truncated at BodyLimit.
+// Compressed bodies are decoded, for logging only.
+// Partial indicates data is a truncated prefix, as when spilled over.
+//
+// JSON, form, and multipart fields are redacted per RedactFields,
+// with a summary logged in place of a body that cannot be parsed for redaction.
+// When redacting, text and form bodies are parsed as JSON when they look so, whatever their type,
+// and other text is summarized, as it cannot be redacted.
+func (opts *Options) formatBody(header http.Header, data []byte, partial bool) any {
+
+	if len(data) == 0 {
+		return ""
+	}
+
+	contentType := header.Get("Content-Type")
+	encoding := header.Get("Content-Encoding")
+	size := len(data)
+
+	if encoding != "" && encoding != "identity" {
+		decoded, err := decode(encoding, data)
+		if err != nil {
+			return summary(contentType, encoding, size)
+		}
+		data = decoded
+		partial = partial || len(data) == maxDecoded
+	}
+
+	knd := kind(contentType, data)
+	if len(opts.redactPaths) > 0 {
+		knd = redactable(knd, data)
+	}
+
+	switch knd {
+	case jsonKind:
+		return opts.formatJson(data, partial, summary(contentType, encoding, size))
+	case formKind:
+		return opts.formatForm(data, partial, summary(contentType, encoding, size))
+	case multipartKind:
+		return opts.formatMultipart(contentType, data, partial, summary(contentType, encoding, size))
+	case binaryKind:
+		return summary(contentType, encoding, size)
+	}
+
+	return opts.truncate(data, partial)
+}
+
+// unexported
+
+type bodyKind int
+
+const (
+	textKind bodyKind = iota
+	jsonKind
+	formKind
+	multipartKind
+	binaryKind
+)
+
+func kind(contentType string, data []byte) bodyKind {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		if utf8.Valid(data) {
+			return textKind
+		}
+		return binaryKind
+	}
+
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return jsonKind
+	case mediaType == "application/x-www-form-urlencoded":
+		return formKind
+	case mediaType == "multipart/form-data":
+		return multipartKind
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		mediaType == "application/x-yaml",
+		mediaType == "application/yaml":
+		return textKind
+	}
+
+	return binaryKind
+}
+
+// redactable gets the kind a body is redacted as, as labels may mislead.
+func redactable(knd bodyKind, data []byte) bodyKind {
+
+	if knd != textKind && knd != formKind {
+		return knd
+	}
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return jsonKind
+	}
+	if knd == textKind {
+		return binaryKind
+	}
+
+	return knd
+}
+
+func (opts *Options) formatJson(data []byte, partial bool, smry string) any {
+
+	redacting := len(opts.redactPaths) > 0
+	over := opts.BodyLimit != 0 && len(data) > opts.BodyLimit
+
+	if partial || over && !redacting {
+		if redacting {
+			return smry
+		}
+		return opts.truncate(data, partial)
+	}
+
+	parsed, ok := parseJson(data)
+	if !ok {
+		if redacting {
+			return smry
+		}
+		return opts.truncate(data, false)
+	}
+	parsed = opts.redactJson(parsed, nil)
+
+	if !over {
+		return parsed
+	}
+
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return smry
+	}
+	return opts.truncate(data, false)
+}
+
+func (opts *Options) formatForm(data []byte, partial bool, smry string) any {
+
+	if len(opts.redactPaths) == 0 {
+		return opts.truncate(data, partial)
+	}
+	if partial {
+		return smry
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return smry
+	}
+
+	return opts.truncate([]byte(opts.redactForm(values).Encode()), false)
+}
+
+func (opts *Options) formatMultipart(contentType string, data []byte, partial bool, smry string) any {
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || partial || params["boundary"] == "" {
+		return smry
+	}
+
+	fields := map[string][]string{}
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return smry
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return smry
+		}
+
+		name := part.FormName()
+		switch {
+		case opts.redactKey([]string{name}):
+			fields[name] = append(fields[name], redacted)
+		case part.FileName() != "":
+			file := fmt.Sprintf("--file %s: %s, %d bytes--", part.FileName(), part.Header.Get("Content-Type"), len(value))
+			fields[name] = append(fields[name], file)
+		default:
+			fields[name] = append(fields[name], opts.truncate(value, false))
+		}
+	}
+
+	return fields
+}
+
+func parseJson(data []byte) (parsed any, ok bool) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&parsed)
+	if err != nil || decoder.More() {
+		return
+	}
+
+	ok = true
+	return
+}
+
+func (opts *Options) truncate(data []byte, partial bool) string {
+
+	if opts.BodyLimit == 0 || len(data) <= opts.BodyLimit {
+		if partial {
+			return string(data) + truncated
+		}
+		return string(data)
+	}
+
+	// back up to the start of a rune
+	cut := opts.BodyLimit
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+
+	return string(data[:cut]) + truncated
+}
+
+func summary(contentType, encoding string, size int) string {
+
+	if contentType == "" {
+		contentType = "unknown"
+	}
+	if encoding != "" {
+		contentType += "; " + encoding
+	}
+
+	return fmt.Sprintf("--%s: %d bytes--", contentType, size)
+}
+
+func decode(encoding string, data []byte) (decoded []byte, err error) {
+
+	var reader io.ReadCloser
+
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+	case "deflate":
+		// usually zlib wrapped, though sometimes raw
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+	default:
+		err = errors.Errorf("unsupported encoding: %s", encoding)
+		return
+	}
+	defer reader.Close()
+
+	decoded, err = io.ReadAll(io.LimitReader(reader, int64(maxDecoded)))
+	if err == io.ErrUnexpectedEOF && len(decoded) > 0 {
+		// a prefix, as when spilled over, decodes to a prefix
+		err = nil
+	}
+	return
+}
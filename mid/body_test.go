@@ -0,0 +1,136 @@
+package mid
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Body", func() {
+	var (
+		opts *Options
+	)
+
+	BeforeEach(func() {
+		opts = &Options{BodyLimit: 9}
+	})
+
+	DescribeTable("formatting for logging",
+		func(contentType, encoding string, data []byte, partial bool, expected any) {
+			header := http.Header{}
+			if contentType != "" {
+				header.Set("Content-Type", contentType)
+			}
+			if encoding != "" {
+				header.Set("Content-Encoding", encoding)
+			}
+
+			Expect(opts.formatBody(header, data, partial)).To(Equal(expected))
+		},
+		Entry("empty", "application/json", "", []byte{}, false, ""),
+		Entry("json is parsed",
+			"application/json; charset=utf-8", "", []byte(`{"n":1}`), false,
+			map[string]any{"n": json.Number("1")}),
+		Entry("json suffix is parsed",
+			"application/problem+json", "", []byte(`[1]`), false,
+			[]any{json.Number("1")}),
+		Entry("invalid json is text",
+			"application/json", "", []byte(`{"n":`), false, `{"n":`),
+		Entry("json over the limit is truncated text",
+			"application/json", "", []byte(`{"ima":"pc"}`), false, `{"ima":"p--truncated--`),
+		Entry("partial json is truncated text",
+			"application/json", "", []byte(`{"ima"`), true, `{"ima"--truncated--`),
+		Entry("text under the limit is as is",
+			"text/plain", "", []byte("ima pc"), false, "ima pc"),
+		Entry("text over the limit is truncated on a rune boundary",
+			"text/plain", "", []byte("ima pc ☃☃"), false, "ima pc --truncated--"),
+		Entry("form is text",
+			"application/x-www-form-urlencoded", "", []byte("a=b"), false, "a=b"),
+		Entry("binary is summarized",
+			"image/png", "", []byte{0x89, 'P', 'N', 'G'}, false, "--image/png: 4 bytes--"),
+		Entry("untyped utf8 is text",
+			"", "", []byte("ima pc"), false, "ima pc"),
+		Entry("untyped non-utf8 is summarized",
+			"", "", []byte{0xff, 0xfe}, false, "--unknown: 2 bytes--"),
+		Entry("gzip is decoded",
+			"application/json", "gzip", gzipped(`{"n":1}`), false,
+			map[string]any{"n": json.Number("1")}),
+		Entry("partial gzip is decoded as partial",
+			"text/plain", "gzip", flushed("ima pc"), true, "ima pc--truncated--"),
+		Entry("bad gzip is summarized",
+			"text/plain", "gzip", []byte("ima pc"), false, "--text/plain; gzip: 6 bytes--"),
+		Entry("unknown encoding is summarized",
+			"text/plain", "br", []byte("ima pc"), false, "--text/plain; br: 6 bytes--"),
+	)
+
+	When("there is no limit", func() {
+		BeforeEach(func() {
+			opts.BodyLimit = 0
+		})
+
+		It("does not truncate", func() {
+			Expect(opts.formatBody(http.Header{}, []byte("ima pc ☃☃"), false)).To(Equal("ima pc ☃☃"))
+		})
+	})
+
+	Describe("logging a gzipped response", func() {
+		var (
+			lgr      *LoggerMock
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			lgr = &LoggerMock{
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+			}
+			recorder = httptest.NewRecorder()
+
+			handler := NewLogging(lgr).LogResponse(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.Header().Set("Content-Encoding", "gzip")
+				_, err := writer.Write(gzipped(`{"ima":"pc"}`))
+				Expect(err).ToNot(HaveOccurred())
+			}))
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		})
+
+		It("logs the decoded body and the response is still compressed", func() {
+			ic := lgr.TraceCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Kv).To(ContainElements("body", map[string]any{"ima": "pc"}))
+
+			Expect(recorder.Body.Bytes()).To(Equal(gzipped(`{"ima":"pc"}`)))
+		})
+	})
+})
+
+func gzipped(data string) []byte {
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+
+	_, err := gz.Write([]byte(data))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(gz.Close()).To(Succeed())
+
+	return buf.Bytes()
+}
+
+// flushed gzips data, cut at a flush point, so that all of data is decoded and nothing after.
+func flushed(data string) []byte {
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+
+	_, err := gz.Write([]byte(data))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(gz.Flush()).To(Succeed())
+
+	return buf.Bytes()
+}
@@ -0,0 +1,160 @@
+package mid
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type clientIPKey struct{}
+
+// ClientIP gets the client ip stored in ctx by LogRequest, blank when not found.
+//
+// It is the remote ip unless that is a trusted proxy, in which case it is derived
+// from Forwarded, X-Forwarded-For, or X-Real-Ip, in that order of preference.
+func ClientIP(ctx context.Context) string {
+
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// unexported
+
+func withClientIP(ctx context.Context, ip string) context.Context {
+
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// clientIP derives the client ip, walking forwarded hops from the right while they are trusted.
+func (opts *Options) clientIP(header http.Header, remote string) (client string) {
+
+	client = remote
+	if !opts.trusted(remote) {
+		return
+	}
+
+	hops := forwardedFor(header)
+	if len(hops) == 0 {
+		hops = splitList(header.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		hops = splitList(header.Values("X-Real-Ip"))
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			return
+		}
+
+		client = addr
+		if !opts.trusted(addr) {
+			return
+		}
+	}
+
+	return
+}
+
+func (opts *Options) trusted(ip string) bool {
+
+	if len(opts.TrustedProxies) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range opts.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedFor gets "for" values from RFC 7239 Forwarded headers.
+func forwardedFor(header http.Header) (hops []string) {
+
+	for _, elem := range splitList(header.Values("Forwarded")) {
+		for _, pair := range strings.Split(elem, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops = append(hops, strings.Trim(val, `"`))
+			}
+		}
+	}
+
+	return
+}
+
+func splitList(vals []string) (items []string) {
+
+	for _, val := range vals {
+		for _, item := range strings.Split(val, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return
+}
+
+// parseHop parses an ip, with or without port and brackets, such as "[2001:db8::1]:4711".
+func parseHop(hop string) (ip string, ok bool) {
+
+	addrPort, err := netip.ParseAddrPort(hop)
+	if err == nil {
+		return addrPort.Addr().Unmap().String(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return
+	}
+
+	return addr.Unmap().String(), true
+}
+
+// parsePrefixes parses cidrs, taking a bare ip as a single address.
+func parsePrefixes(cidrs []string) (prefixes []netip.Prefix, err error) {
+
+	for _, cidr := range cidrs {
+
+		var prefix netip.Prefix
+		prefix, err = netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				err = errors.Wrapf(err, "failed to parse trusted proxy")
+				return
+			}
+			prefix, err = addr.Prefix(addr.BitLen())
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return
+}
+
+func ipPort(addr string) (ip, port string) {
+
+	ip, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// no port, or not an address at all
+		return addr, ""
+	}
+
+	return
+}
@@ -0,0 +1,112 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClientIP", func() {
+	var (
+		opts *Options
+	)
+
+	BeforeEach(func() {
+		opts = &Options{
+			TrustedProxies: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("fd00::/8"),
+			},
+		}
+	})
+
+	DescribeTable("splitting remote addr",
+		func(addr, ip, port string) {
+			gotIp, gotPort := ipPort(addr)
+			Expect(gotIp).To(Equal(ip))
+			Expect(gotPort).To(Equal(port))
+		},
+		Entry("ipv4", "10.11.12.13:34562", "10.11.12.13", "34562"),
+		Entry("ipv6", "[::1]:1234", "::1", "1234"),
+		Entry("ipv6 with zone", "[fe80::1%eth0]:1234", "fe80::1%eth0", "1234"),
+		Entry("no port", "10.11.12.13", "10.11.12.13", ""),
+		Entry("empty", "", "", ""),
+	)
+
+	DescribeTable("deriving the client ip",
+		func(remote string, header http.Header, expected string) {
+			Expect(opts.clientIP(header, remote)).To(Equal(expected))
+		},
+		Entry("untrusted remote ignores headers",
+			"203.0.113.9", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.9"),
+		Entry("trusted remote without headers",
+			"10.0.0.1", http.Header{}, "10.0.0.1"),
+		Entry("x-forwarded-for",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"),
+		Entry("x-forwarded-for skips trusted hops from the right",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"6.6.6.6, 198.51.100.1", "10.0.0.2"}}, "198.51.100.1"),
+		Entry("x-forwarded-for all trusted gives leftmost",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"),
+		Entry("x-forwarded-for invalid hop stops the walk",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"198.51.100.1, bogus, 10.0.0.2"}}, "10.0.0.2"),
+		Entry("x-real-ip",
+			"10.0.0.1", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"),
+		Entry("forwarded is preferred",
+			"10.0.0.1", http.Header{
+				"Forwarded":       {`for=192.0.2.60;proto=http;by=203.0.113.43`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			}, "192.0.2.60"),
+		Entry("forwarded with ipv6 and port",
+			"fd00::1", http.Header{"Forwarded": {`For="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"),
+		Entry("forwarded with multiple elements",
+			"10.0.0.1", http.Header{"Forwarded": {"for=192.0.2.43, for=10.0.0.9"}}, "192.0.2.43"),
+		Entry("forwarded obfuscated stops the walk",
+			"10.0.0.1", http.Header{"Forwarded": {"for=_hidden"}}, "10.0.0.1"),
+		Entry("ipv4 mapped ipv6 proxy is trusted",
+			"::ffff:10.0.0.1", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"),
+	)
+
+	Describe("logging a request from behind a trusted proxy", func() {
+		var (
+			lgr *LoggerMock
+			ip  string
+		)
+
+		BeforeEach(func() {
+			lgr = &LoggerMock{
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+				WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+					return ctx
+				},
+			}
+
+			lg := NewLogging(lgr, WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8")))
+			handler := lg.LogRequest(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				ip = ClientIP(request.Context())
+			}))
+
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = "10.0.0.1:34562"
+			request.Header.Set("X-Forwarded-For", "198.51.100.1")
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		})
+
+		It("logs the client ip and stores it in the context", func() {
+			ic := lgr.TraceCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Kv).To(ContainElements("remote_ip", "10.0.0.1", "client_ip", "198.51.100.1"))
+
+			Expect(ip).To(Equal("198.51.100.1"))
+		})
+	})
+
+	When("nothing is stored", func() {
+		It("is blank", func() {
+			Expect(ClientIP(context.Background())).To(Equal(""))
+		})
+	})
+})
@@ -0,0 +1,454 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"sort"
+	"sync/atomic"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/requestid"
+	"github.com/pkg/errors"
+)
+
+// Options configure request and response logging.
+//
+// Bodies are logged unless SkipBody, and always when the path matches BodyPattern.
+// Logged bodies are parsed when JSON, summarized when binary, and otherwise truncated at BodyLimit.
+// RedactFields are names, or paths such as "$.user.password" and "$..token", of JSON and form fields.
+// RedactHeaders are case-insensitive names, or globs such as "X-*-Token", of request and response headers.
+// When AllowHeaders are given, only headers matching them are logged.
+// RedactQuery are names, or globs such as "*token*", of query parameters.
+// Forwarding headers are believed only from TrustedProxies, see ClientIP.
+// Sampler, when not nil, selects which requests are logged.
+// Requests beyond Slow, or that of their route in SlowRoutes, are logged and counted.
+// IDGenerator generates request ids, such as requestid.UUIDv7, when not given by the client.
+// Responses to paths matching StreamPattern, or with a content type matching StreamTypes,
+// are streamed through unbuffered, see LogStreaming.
+// SkipPreflight skips logging of CORS preflight requests, as does SkipPattern by path.
+// MaskRoutes are patterns such as "/reset/{token}" with wildcard segments masked in the logged path.
+type Options struct {
+	RedactHeaders  map[string]bool
+	AllowHeaders   []string
+	RedactFields   []string
+	RedactQuery    []string
+	MaskRoutes     []string
+	TrustedProxies []netip.Prefix
+	IDGenerator    requestid.Generator
+	Sampler        *Sampler
+	Slow           Threshold
+	SlowRoutes     map[string]Threshold
+	slowCounter    *slowCounter
+	SkipPattern    *regexp.Regexp
+	SkipPreflight  bool
+	SkipBody       bool
+	BodyPattern    *regexp.Regexp
+	BodyLimit      int
+	BufferLimit    int
+	StreamPattern  *regexp.Regexp
+	StreamTypes    []string
+	redactPaths    []fieldPath
+	routes         []route
+}
+
+// Settings are Options as json, for adjusting at runtime.
+type Settings struct {
+	RedactHeaders  []string                     `json:"redact_headers"`
+	AllowHeaders   []string                     `json:"allow_headers"`
+	RedactFields   []string                     `json:"redact_fields"`
+	RedactQuery    []string                     `json:"redact_query"`
+	MaskRoutes     []string                     `json:"mask_routes"`
+	TrustedProxies []string                     `json:"trusted_proxies"`
+	SkipPattern    string                       `json:"skip_pattern"`
+	SkipPreflight  bool                         `json:"skip_preflight"`
+	SkipBody       bool                         `json:"skip_body"`
+	BodyPattern    string                       `json:"body_pattern"`
+	BodyLimit      int                          `json:"body_limit"`
+	BufferLimit    int                          `json:"buffer_limit"`
+	StreamPattern  string                       `json:"stream_pattern"`
+	StreamTypes    []string                     `json:"stream_types"`
+	Sampler        *SamplerSettings             `json:"sampler"`
+	Slow           ThresholdSettings            `json:"slow"`
+	SlowRoutes     map[string]ThresholdSettings `json:"slow_routes"`
+}
+
+// Option sets an option.
+type Option func(opts *Options)
+
+// WithRedactHeaders redacts headers by name or glob, in any case.
+func WithRedactHeaders(names ...string) Option {
+
+	return func(opts *Options) {
+		for _, name := range names {
+			opts.RedactHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// WithAllowHeaders logs only headers matching the given names or globs.
+func WithAllowHeaders(names ...string) Option {
+
+	return func(opts *Options) {
+		opts.AllowHeaders = append(opts.AllowHeaders, names...)
+	}
+}
+
+// WithRedactFields redacts JSON and form fields in logged bodies, by name or path.
+func WithRedactFields(fields ...string) Option {
+
+	return func(opts *Options) {
+		opts.RedactFields = append(opts.RedactFields, fields...)
+	}
+}
+
+// WithRedactQuery redacts query parameters in logged requests, by name or glob.
+func WithRedactQuery(names ...string) Option {
+
+	return func(opts *Options) {
+		opts.RedactQuery = append(opts.RedactQuery, names...)
+	}
+}
+
+// WithMaskRoutes masks wildcard segments, as with "/reset/{token}", of matching logged paths.
+func WithMaskRoutes(patterns ...string) Option {
+
+	return func(opts *Options) {
+		opts.MaskRoutes = append(opts.MaskRoutes, patterns...)
+	}
+}
+
+// WithTrustedProxies trusts forwarding headers from remote addresses within prefixes.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+
+	return func(opts *Options) {
+		opts.TrustedProxies = append(opts.TrustedProxies, prefixes...)
+	}
+}
+
+// WithIDGenerator generates request ids with gen.
+func WithIDGenerator(gen requestid.Generator) Option {
+
+	return func(opts *Options) {
+		opts.IDGenerator = gen
+	}
+}
+
+// WithSkipPattern skips logging of requests with a path matching pattern.
+func WithSkipPattern(pattern *regexp.Regexp) Option {
+
+	return func(opts *Options) {
+		opts.SkipPattern = pattern
+	}
+}
+
+// WithSkipPreflight skips logging of CORS preflight requests.
+func WithSkipPreflight() Option {
+
+	return func(opts *Options) {
+		opts.SkipPreflight = true
+	}
+}
+
+// WithSkipBody skips logging of request and response bodies.
+func WithSkipBody() Option {
+
+	return func(opts *Options) {
+		opts.SkipBody = true
+	}
+}
+
+// WithBodyPattern logs bodies of requests with a path matching pattern, regardless of skip body.
+func WithBodyPattern(pattern *regexp.Regexp) Option {
+
+	return func(opts *Options) {
+		opts.BodyPattern = pattern
+	}
+}
+
+// WithBodyLimit truncates logged bodies at limit bytes, with zero for no limit.
+func WithBodyLimit(limit int) Option {
+
+	return func(opts *Options) {
+		opts.BodyLimit = limit
+	}
+}
+
+// WithBufferLimit limits response buffering to limit bytes, with zero for no limit.
+func WithBufferLimit(limit int) Option {
+
+	return func(opts *Options) {
+		opts.BufferLimit = limit
+	}
+}
+
+// WithStreamPattern streams responses to requests with a path matching pattern.
+func WithStreamPattern(pattern *regexp.Regexp) Option {
+
+	return func(opts *Options) {
+		opts.StreamPattern = pattern
+	}
+}
+
+// WithStreamTypes streams responses with a content type matching the given names or globs,
+// replacing the defaults of "text/event-stream" and "application/octet-stream".
+func WithStreamTypes(types ...string) Option {
+
+	return func(opts *Options) {
+		opts.StreamTypes = types
+	}
+}
+
+// Logging provides request and response logging middleware sharing per-instance options.
+//
+// Options are swapped atomically by Apply and Update, so Logging is safe for concurrent use.
+// Each request sees a consistent snapshot.
+type Logging struct {
+	logger  logger.Logger
+	options atomic.Pointer[Options]
+}
+
+// NewLogging creates Logging with options.
+func NewLogging(lgr logger.Logger, opts ...Option) *Logging {
+
+	options := &Options{
+		RedactHeaders: map[string]bool{},
+		BodyLimit:     defaultBodyLimit,
+		BufferLimit:   defaultBufferLimit,
+		StreamTypes:   defaultStreamTypes,
+		slowCounter:   &slowCounter{},
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.redactPaths = compileFields(options.RedactFields)
+	options.routes = compileRoutes(options.MaskRoutes)
+
+	lg := &Logging{
+		logger: lgr,
+	}
+	lg.options.Store(options)
+
+	return lg
+}
+
+// LogRequest is a middleware which logs the request.
+//
+// Only request_id and client ip are added to the context when the logger reports trace is not enabled.
+func (lg *Logging) LogRequest(next http.Handler) http.HandlerFunc {
+
+	return logRequest(lg.logger, lg.current, next)
+}
+
+// LogResponse is a middleware which logs the response.
+//
+// See package level LogResponse regarding streaming and truncation.
+// Responses matching StreamPattern or StreamTypes are logged as with LogStreaming.
+func (lg *Logging) LogResponse(next http.Handler) http.HandlerFunc {
+
+	return logResponse(lg.logger, lg.current, next)
+}
+
+// LogStreaming is a middleware which logs the response without buffering.
+func (lg *Logging) LogStreaming(next http.Handler) http.HandlerFunc {
+
+	return logStreaming(lg.logger, lg.current, next)
+}
+
+// Wrap wraps next with both response and request logging.
+func (lg *Logging) Wrap(next http.Handler) http.Handler {
+
+	return lg.LogRequest(lg.LogResponse(next))
+}
+
+// Settings gets the current options as settings.
+func (lg *Logging) Settings() Settings {
+
+	return lg.current().settings()
+}
+
+// Apply replaces the current options with settings, logging the change.
+//
+// Blank patterns are cleared.
+// IDGenerator is not a setting and is carried over, as are slow counts.
+func (lg *Logging) Apply(ctx context.Context, settings Settings) (err error) {
+
+	return lg.Update(ctx, func(current *Settings) error {
+		*current = settings
+		return nil
+	})
+}
+
+// Update applies change to the current settings, logging the change.
+//
+// Should settings be applied by another meanwhile, change is retried with theirs,
+// so that neither is lost.
+func (lg *Logging) Update(ctx context.Context, change func(settings *Settings) error) (err error) {
+
+	for {
+		current := lg.current()
+
+		settings := current.settings()
+		err = change(&settings)
+		if err != nil {
+			return
+		}
+
+		var opts *Options
+		opts, err = settings.options(current)
+		if err != nil {
+			return
+		}
+
+		if lg.options.CompareAndSwap(current, opts) {
+			lg.logger.Info(ctx, "logging settings updated", "previous", current.settings(), "current", opts.settings())
+			return
+		}
+	}
+}
+
+// SlowCounts gets counts of slow requests since creation.
+func (lg *Logging) SlowCounts() SlowCounts {
+
+	return lg.current().slowCounter.counts()
+}
+
+// unexported
+
+// settings gets options as settings.
+func (opts *Options) settings() (settings Settings) {
+
+	settings = Settings{
+		RedactHeaders:  []string{},
+		AllowHeaders:   append([]string{}, opts.AllowHeaders...),
+		RedactFields:   append([]string{}, opts.RedactFields...),
+		RedactQuery:    append([]string{}, opts.RedactQuery...),
+		MaskRoutes:     append([]string{}, opts.MaskRoutes...),
+		TrustedProxies: []string{},
+		StreamTypes:    append([]string{}, opts.StreamTypes...),
+		SkipPreflight:  opts.SkipPreflight,
+		SkipBody:       opts.SkipBody,
+		BodyLimit:      opts.BodyLimit,
+		BufferLimit:    opts.BufferLimit,
+	}
+
+	for name, ok := range opts.RedactHeaders {
+		if ok {
+			settings.RedactHeaders = append(settings.RedactHeaders, name)
+		}
+	}
+	sort.Strings(settings.RedactHeaders)
+
+	for _, prefix := range opts.TrustedProxies {
+		settings.TrustedProxies = append(settings.TrustedProxies, prefix.String())
+	}
+
+	if opts.Sampler != nil {
+		settings.Sampler = opts.Sampler.Settings()
+	}
+
+	settings.Slow = opts.Slow.Settings()
+	settings.SlowRoutes = map[string]ThresholdSettings{}
+	for route, threshold := range opts.SlowRoutes {
+		settings.SlowRoutes[route] = threshold.Settings()
+	}
+	if opts.SkipPattern != nil {
+		settings.SkipPattern = opts.SkipPattern.String()
+	}
+	if opts.BodyPattern != nil {
+		settings.BodyPattern = opts.BodyPattern.String()
+	}
+	if opts.StreamPattern != nil {
+		settings.StreamPattern = opts.StreamPattern.String()
+	}
+
+	return
+}
+
+// options gets settings as options, carrying over IDGenerator and slow counts from current.
+func (settings Settings) options(current *Options) (opts *Options, err error) {
+
+	opts = &Options{
+		IDGenerator:   current.IDGenerator,
+		slowCounter:   current.slowCounter,
+		RedactHeaders: map[string]bool{},
+		AllowHeaders:  settings.AllowHeaders,
+		RedactFields:  settings.RedactFields,
+		RedactQuery:   settings.RedactQuery,
+		MaskRoutes:    settings.MaskRoutes,
+		redactPaths:   compileFields(settings.RedactFields),
+		routes:        compileRoutes(settings.MaskRoutes),
+		SkipPreflight: settings.SkipPreflight,
+		SkipBody:      settings.SkipBody,
+		BodyLimit:     settings.BodyLimit,
+		BufferLimit:   settings.BufferLimit,
+		StreamTypes:   settings.StreamTypes,
+	}
+
+	for _, name := range settings.RedactHeaders {
+		opts.RedactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+
+	err = checkGlobs(settings.RedactHeaders, settings.AllowHeaders, settings.RedactQuery, settings.StreamTypes)
+	if err != nil {
+		return
+	}
+
+	opts.TrustedProxies, err = parsePrefixes(settings.TrustedProxies)
+	if err != nil {
+		return
+	}
+
+	if settings.Sampler != nil {
+		opts.Sampler, err = settings.Sampler.New()
+		if err != nil {
+			return
+		}
+	}
+
+	opts.Slow, err = settings.Slow.Threshold()
+	if err != nil {
+		return
+	}
+
+	for route, threshold := range settings.SlowRoutes {
+		if opts.SlowRoutes == nil {
+			opts.SlowRoutes = map[string]Threshold{}
+		}
+		opts.SlowRoutes[route], err = threshold.Threshold()
+		if err != nil {
+			return
+		}
+	}
+
+	opts.SkipPattern, err = compile(settings.SkipPattern)
+	if err != nil {
+		return
+	}
+
+	opts.BodyPattern, err = compile(settings.BodyPattern)
+	if err != nil {
+		return
+	}
+
+	opts.StreamPattern, err = compile(settings.StreamPattern)
+	return
+}
+
+func (lg *Logging) current() *Options {
+
+	return lg.options.Load()
+}
+
+func compile(pattern string) (rx *regexp.Regexp, err error) {
+
+	if pattern == "" {
+		return
+	}
+
+	rx, err = regexp.Compile(pattern)
+	err = errors.Wrapf(err, "failed to compile pattern")
+	return
+}
@@ -0,0 +1,443 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/delish/cors"
+	"github.com/clarktrimble/delish/requestid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logging", func() {
+	var (
+		lg  *Logging
+		lgr *LoggerMock
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+	})
+
+	Describe("creating with options", func() {
+
+		When("no options are given", func() {
+			BeforeEach(func() {
+				lg = NewLogging(lgr)
+			})
+
+			It("has defaults", func() {
+				Expect(lg.current()).To(Equal(&Options{
+					RedactHeaders: map[string]bool{},
+					BodyLimit:     4 << 10,
+					BufferLimit:   1 << 20,
+					StreamTypes:   []string{"text/event-stream", "application/octet-stream"},
+					slowCounter:   &slowCounter{},
+				}))
+			})
+		})
+
+		When("all options are given", func() {
+			BeforeEach(func() {
+				lg = NewLogging(lgr,
+					WithRedactHeaders("x-authorization-token", "Cookie"),
+					WithRedactFields("password"),
+					WithSkipPattern(regexp.MustCompile("^/monitor")),
+					WithSkipPreflight(),
+					WithSkipBody(),
+					WithBodyLimit(33),
+					WithBufferLimit(99),
+					WithSlow(Threshold{Info: time.Second}),
+					WithSlowRoute("GET /reports", Threshold{Info: 5 * time.Second, Error: time.Minute}),
+					WithStreamPattern(regexp.MustCompile("^/events")),
+					WithStreamTypes("video/*"),
+				)
+			})
+
+			It("has them", func() {
+				Expect(lg.current()).To(Equal(&Options{
+					RedactHeaders: map[string]bool{"X-Authorization-Token": true, "Cookie": true},
+					RedactFields:  []string{"password"},
+					SkipPattern:   regexp.MustCompile("^/monitor"),
+					SkipPreflight: true,
+					SkipBody:      true,
+					BodyLimit:     33,
+					BufferLimit:   99,
+					StreamPattern: regexp.MustCompile("^/events"),
+					StreamTypes:   []string{"video/*"},
+					Slow:          Threshold{Info: time.Second},
+					SlowRoutes:    map[string]Threshold{"GET /reports": {Info: 5 * time.Second, Error: time.Minute}},
+					redactPaths:   []fieldPath{{{name: "password", deep: true}}},
+					slowCounter:   &slowCounter{},
+				}))
+			})
+		})
+	})
+
+	Describe("applying settings", func() {
+		var (
+			settings Settings
+			err      error
+		)
+
+		BeforeEach(func() {
+			lgr.InfoFunc = func(ctx context.Context, msg string, kv ...any) {}
+			lg = NewLogging(lgr, WithSkipBody())
+		})
+
+		JustBeforeEach(func() {
+			err = lg.Apply(context.Background(), settings)
+		})
+
+		When("all is well", func() {
+			BeforeEach(func() {
+				settings = Settings{
+					RedactHeaders:  []string{"x-authorization-token", "Cookie"},
+					AllowHeaders:   []string{"Content-Type", "X-*"},
+					RedactFields:   []string{"$.user.password"},
+					RedactQuery:    []string{"*token*"},
+					MaskRoutes:     []string{"/reset/{token}"},
+					TrustedProxies: []string{"10.1.2.3/8", "192.168.1.1"},
+					SkipPattern:    "^/monitor",
+					SkipPreflight:  true,
+					SkipBody:       true,
+					BodyPattern:    "^/users",
+					BufferLimit:    99,
+					StreamPattern:  "^/events",
+					StreamTypes:    []string{"video/*"},
+					Slow:           ThresholdSettings{Info: "1s"},
+					SlowRoutes:     map[string]ThresholdSettings{"GET /reports": {Info: "5s", Error: "1m0s"}},
+				}
+			})
+
+			It("replaces options and logs the change", func() {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lg.current()).To(Equal(&Options{
+					RedactHeaders:  map[string]bool{"X-Authorization-Token": true, "Cookie": true},
+					AllowHeaders:   []string{"Content-Type", "X-*"},
+					RedactFields:   []string{"$.user.password"},
+					RedactQuery:    []string{"*token*"},
+					MaskRoutes:     []string{"/reset/{token}"},
+					TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.1/32")},
+					SkipPattern:    regexp.MustCompile("^/monitor"),
+					SkipPreflight:  true,
+					SkipBody:       true,
+					BodyPattern:    regexp.MustCompile("^/users"),
+					BufferLimit:    99,
+					StreamPattern:  regexp.MustCompile("^/events"),
+					StreamTypes:    []string{"video/*"},
+					Slow:           Threshold{Info: time.Second},
+					SlowRoutes:     map[string]Threshold{"GET /reports": {Info: 5 * time.Second, Error: time.Minute}},
+					redactPaths:    []fieldPath{{{name: "user"}, {name: "password"}}},
+					routes:         []route{{"", "reset", ""}},
+					slowCounter:    &slowCounter{},
+				}))
+				Expect(lg.Settings()).To(Equal(Settings{
+					RedactHeaders:  []string{"Cookie", "X-Authorization-Token"},
+					AllowHeaders:   []string{"Content-Type", "X-*"},
+					RedactFields:   []string{"$.user.password"},
+					RedactQuery:    []string{"*token*"},
+					MaskRoutes:     []string{"/reset/{token}"},
+					TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1/32"},
+					SkipPattern:    "^/monitor",
+					SkipPreflight:  true,
+					SkipBody:       true,
+					BodyPattern:    "^/users",
+					BufferLimit:    99,
+					StreamPattern:  "^/events",
+					StreamTypes:    []string{"video/*"},
+					Slow:           ThresholdSettings{Info: "1s"},
+					SlowRoutes:     map[string]ThresholdSettings{"GET /reports": {Info: "5s", Error: "1m0s"}},
+				}))
+
+				ic := lgr.InfoCalls()
+				Expect(ic).To(HaveLen(1))
+				Expect(ic[0].Msg).To(Equal("logging settings updated"))
+				Expect(ic[0].Kv).To(HaveLen(4))
+				Expect(ic[0].Kv[1]).To(HaveField("SkipPattern", ""))
+				Expect(ic[0].Kv[3]).To(HaveField("SkipPattern", "^/monitor"))
+			})
+		})
+
+		When("a threshold is invalid", func() {
+			BeforeEach(func() {
+				settings = Settings{SlowRoutes: map[string]ThresholdSettings{"/": {Error: "soon"}}}
+			})
+
+			It("returns an error and leaves options as is", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse threshold")))
+				Expect(lg.current().SkipBody).To(BeTrue())
+				Expect(lgr.InfoCalls()).To(BeEmpty())
+			})
+		})
+
+		When("a glob is invalid", func() {
+			BeforeEach(func() {
+				settings = Settings{RedactHeaders: []string{"X-[oops"}}
+			})
+
+			It("returns an error and leaves options as is", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to compile glob")))
+				Expect(lg.current().SkipBody).To(BeTrue())
+				Expect(lgr.InfoCalls()).To(BeEmpty())
+			})
+		})
+
+		When("a trusted proxy is invalid", func() {
+			BeforeEach(func() {
+				settings = Settings{TrustedProxies: []string{"10.0.0.0/33"}}
+			})
+
+			It("returns an error and leaves options as is", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to parse trusted proxy")))
+				Expect(lg.current().SkipBody).To(BeTrue())
+				Expect(lgr.InfoCalls()).To(BeEmpty())
+			})
+		})
+
+		When("a pattern is invalid", func() {
+			BeforeEach(func() {
+				settings = Settings{BodyPattern: "(oops"}
+			})
+
+			It("returns an error and leaves options as is", func() {
+				Expect(err).To(MatchError(ContainSubstring("failed to compile pattern")))
+				Expect(lg.current().SkipBody).To(BeTrue())
+				Expect(lgr.InfoCalls()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("logging bodies by pattern", func() {
+
+		BeforeEach(func() {
+			lg = NewLogging(lgr, WithSkipBody(), WithBodyPattern(regexp.MustCompile("^/users")))
+		})
+
+		JustBeforeEach(func() {
+			handler := lg.Wrap(jsonHandler(200, `{"ima":"pc"}`))
+			for _, path := range []string{"/users/1", "/report"} {
+				request := httptest.NewRequest("POST", path, bytes.NewBufferString(`{"ima":"pc"}`))
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+			}
+		})
+
+		It("logs bodies only for matching paths", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(4))
+			Expect(tc[0].Kv).To(ContainElement("body"))
+			Expect(tc[1].Kv).To(ContainElement("body"))
+			Expect(tc[2].Kv).ToNot(ContainElement("body"))
+			Expect(tc[3].Kv).ToNot(ContainElement("body"))
+		})
+	})
+
+	Describe("applying settings while serving", func() {
+
+		BeforeEach(func() {
+			lgr.InfoFunc = func(ctx context.Context, msg string, kv ...any) {}
+			lg = NewLogging(lgr)
+		})
+
+		It("is safe for concurrent use", func() {
+			handler := lg.Wrap(jsonHandler(200, `{"ima":"pc"}`))
+			var wg sync.WaitGroup
+
+			for i := range 9 {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					request := httptest.NewRequest("POST", "/report", bytes.NewBufferString(`{"ima":"pc"}`))
+					handler.ServeHTTP(httptest.NewRecorder(), request)
+				}()
+				go func() {
+					defer wg.Done()
+					err := lg.Apply(context.Background(), Settings{SkipBody: i%2 == 0, BufferLimit: 1024})
+					Expect(err).ToNot(HaveOccurred())
+				}()
+			}
+
+			wg.Wait()
+			Expect(lgr.TraceCalls()).To(HaveLen(18))
+			Expect(lgr.InfoCalls()).To(HaveLen(9))
+		})
+
+		It("loses no updates made concurrently", func() {
+			var wg sync.WaitGroup
+			limit := lg.Settings().BufferLimit
+
+			for range 9 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := lg.Update(context.Background(), func(settings *Settings) error {
+						settings.BufferLimit++
+						return nil
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}()
+			}
+
+			wg.Wait()
+			Expect(lg.Settings().BufferLimit).To(Equal(limit + 9))
+
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(9))
+			for _, call := range ic {
+				previous := call.Kv[1].(Settings) //nolint:forcetypeassert // panic ok in test
+				current := call.Kv[3].(Settings)  //nolint:forcetypeassert // panic ok in test
+				Expect(current.BufferLimit).To(Equal(previous.BufferLimit + 1))
+			}
+		})
+	})
+
+	Describe("logging with two instances", func() {
+		var (
+			redacting http.Handler
+			skipping  http.Handler
+		)
+
+		BeforeEach(func() {
+			handler := jsonHandler(200, `{"ima":"pc"}`)
+
+			redacting = NewLogging(lgr, WithRedactHeaders("X-Authorization-Token")).Wrap(handler)
+			skipping = NewLogging(lgr, WithSkipBody(), WithSkipPattern(regexp.MustCompile("^/monitor"))).Wrap(handler)
+		})
+
+		JustBeforeEach(func() {
+			var wg sync.WaitGroup
+
+			for _, handler := range []http.Handler{redacting, skipping} {
+				for _, path := range []string{"/monitor", "/report"} {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						request := httptest.NewRequest("POST", path, bytes.NewBufferString(`{"ima":"pc"}`))
+						request.Header.Set("X-Authorization-Token", "this-is-secret")
+						handler.ServeHTTP(httptest.NewRecorder(), request)
+					}()
+				}
+			}
+
+			wg.Wait()
+		})
+
+		It("logs concurrently per the options of each", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(6)) // 2 x 2 from redacting and 2 x 1 from skipping
+
+			var monitor, redacted, withBody, withoutBody int
+			for _, call := range tc {
+				log := map[string]any{}
+				for i := 0; i < len(call.Kv); i += 2 {
+					log[call.Kv[i].(string)] = call.Kv[i+1] //nolint:forcetypeassert // panic ok in test
+				}
+
+				if call.Msg == "received request" {
+					if log["path"] == "/monitor" {
+						monitor++
+					}
+					hdr := log["headers"].(http.Header) //nolint:forcetypeassert // panic ok in test
+					if hdr.Get("X-Authorization-Token") == "--redacted--" {
+						redacted++
+					}
+				}
+
+				if _, ok := log["body"]; ok {
+					withBody++
+				} else {
+					withoutBody++
+				}
+			}
+
+			Expect(monitor).To(Equal(1))
+			Expect(redacted).To(Equal(2))
+			Expect(withBody).To(Equal(4))
+			Expect(withoutBody).To(Equal(2))
+		})
+	})
+
+	Describe("skipping by pattern", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+			seen     string
+		)
+
+		BeforeEach(func() {
+			handler := NewLogging(lgr, WithSkipPattern(regexp.MustCompile("^/monitor"))).Wrap(
+				http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					seen = requestid.Get(request.Context())
+				}),
+			)
+
+			request := httptest.NewRequest("GET", "/monitor", nil)
+			request.Header.Set("X-Request-Id", "from-upstream-1")
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+		})
+
+		It("does not log, but honors and echoes the request id", func() {
+			Expect(lgr.TraceCalls()).To(BeEmpty())
+			Expect(seen).To(Equal("from-upstream-1"))
+			Expect(recorder.Header().Get("X-Request-Id")).To(Equal("from-upstream-1"))
+		})
+	})
+
+	Describe("logging beside cors", func() {
+		var (
+			handler   http.Handler
+			preflight *httptest.ResponseRecorder
+			actual    *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			rtr := http.NewServeMux()
+			rtr.Handle("GET /items", jsonHandler(200, `{"ima":"pc"}`))
+
+			crs, err := (&cors.Config{AllowOrigins: []string{"https://app.example.com"}}).New()
+			Expect(err).ToNot(HaveOccurred())
+
+			handler = NewLogging(lgr, WithSkipPreflight()).Wrap(crs.Wrap(rtr))
+		})
+
+		JustBeforeEach(func() {
+			request := httptest.NewRequest("OPTIONS", "/items", nil)
+			request.Header.Set("Origin", "https://app.example.com")
+			request.Header.Set("Access-Control-Request-Method", "GET")
+			preflight = httptest.NewRecorder()
+			handler.ServeHTTP(preflight, request)
+
+			request = httptest.NewRequest("GET", "/items", nil)
+			request.Header.Set("Origin", "https://app.example.com")
+			actual = httptest.NewRecorder()
+			handler.ServeHTTP(actual, request)
+		})
+
+		It("skips logging the preflight and exposes the request id", func() {
+			Expect(preflight.Code).To(Equal(http.StatusNoContent))
+			Expect(preflight.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://app.example.com"))
+			Expect(preflight.Header().Get("X-Request-Id")).ToNot(BeEmpty())
+
+			Expect(actual.Code).To(Equal(http.StatusOK))
+			Expect(actual.Header().Get("Access-Control-Expose-Headers")).To(Equal("X-Request-Id"))
+			Expect(actual.Header().Get("X-Request-Id")).ToNot(BeEmpty())
+
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(2))
+			Expect(tc[0].Kv).To(ContainElements("method", "GET"))
+		})
+	})
+})
@@ -2,12 +2,14 @@ package mid
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
+	"time"
 
 	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/requestid"
 	"github.com/clarktrimble/hondo"
 	"github.com/pkg/errors"
 )
@@ -16,74 +18,124 @@ const (
 	idLen int = 7
 )
 
-// LogRequest is a middleware which logs the request.
+// LogRequest is a middleware which logs the request, configured by package vars.
+//
+// The request id is taken from a valid incoming X-Request-Id, or generated,
+// and is echoed in the response header, whether or not the request is skipped.
+// Only request_id and client ip are added to the context when the logger reports trace is not enabled.
+// When sampling, the request is logged only once selected, after the response.
+// Slow requests are logged at info or error, trace or not.
+// See also Logging.LogRequest.
 func LogRequest(lgr logger.Logger, next http.Handler) http.HandlerFunc {
 
+	return logRequest(lgr, globalOptions, next)
+}
+
+// unexported
+
+func logRequest(lgr logger.Logger, options func() *Options, next http.Handler) http.HandlerFunc {
+
 	return func(writer http.ResponseWriter, request *http.Request) {
 
-		if skipLogging(request) {
+		opts := options()
+		ip, port := ipPort(request.RemoteAddr)
+		client := opts.clientIP(request.Header, ip)
+
+		// skipped requests get an id too, for any errors they respond with
+		id := opts.requestID(request.Header)
+		writer.Header().Set(requestid.Header, id)
+
+		ctx := withClientIP(request.Context(), client)
+		ctx = requestid.With(ctx, id)
+		ctx = lgr.WithFields(ctx, "request_id", id)
+		request = request.WithContext(ctx)
+
+		// pattern is set on the request as last passed along, hidden from those beyond
+		defer func() {
+			holdRoute(request)
+		}()
+
+		if opts.skipLogging(request) {
 			next.ServeHTTP(writer, request)
 			return
 		}
 
-		ctx := request.Context()
-		ctx = lgr.WithFields(ctx, "request_id", hondo.Rand(idLen))
-		request = request.WithContext(ctx)
+		if opts.detectsSlow() {
+			// route is known once next returns, when routed by http.ServeMux,
+			// and set on the request as last passed along, sampling or not
+			start := time.Now()
+			defer func() {
+				opts.slow(lgr, request, start)
+			}()
+		}
+
+		if !logger.Enabled(ctx, lgr, traceLevel) {
+			next.ServeHTTP(writer, request)
+			return
+		}
 
-		ip, port := ipPort(request.RemoteAddr)
 		path, query := pathQuery(request.URL)
 
 		fields := []any{
 			"method", request.Method,
-			"path", path,
-			"query", query,
+			"path", opts.maskPath(path),
+			"query", opts.redactQuery(query),
 			"remote_ip", ip,
 			"remote_port", port,
-			"headers", redact(request.Header),
+			"headers", opts.redact(request.Header),
+		}
+
+		if client != ip {
+			fields = append(fields, "client_ip", client)
 		}
 
-		// Todo: config skip body yeah??
-		if !SkipBody {
+		if opts.logBody(request) {
 			body, err := requestBody(request)
 			if err != nil {
 				lgr.Error(ctx, "request logger failed to get body", err)
 			} else {
 				fields = append(fields, "body")
-				fields = append(fields, string(body))
+				fields = append(fields, opts.formatBody(request.Header, body, false))
 			}
 		}
 
-		lgr.Trace(ctx, "received request", fields...)
-		next.ServeHTTP(writer, request)
-	}
-}
+		if opts.Sampler == nil {
+			lgr.Trace(ctx, "received request", fields...)
+			next.ServeHTTP(writer, request)
+			return
+		}
 
-// unexported
+		// hold the line until the response is known, as decided by LogResponse if in play
 
-// Todo: clone already copies everything, loop only needs the redaction check
-func redact(header http.Header) (redacted http.Header) {
+		start := time.Now()
+		smp := &sample{ctx: ctx, fields: fields}
+		request = request.WithContext(withSample(ctx, smp))
 
-	redacted = header.Clone()
-	for key := range header {
+		next.ServeHTTP(writer, request)
 
-		redacted[key] = header[key]
-		if RedactHeaders[key] {
-			redacted[key] = []string{"--redacted--"}
+		if !smp.decided {
+			smp.decide(lgr, opts.Sampler.Decide(routeOf(request), client, 0, time.Since(start)))
 		}
 	}
+}
 
-	return
+// RequestID gets the request id stored in ctx by LogRequest, blank when not found.
+func RequestID(ctx context.Context) string {
+
+	return requestid.Get(ctx)
 }
 
-func ipPort(addr string) (ip, port string) {
+func (opts *Options) requestID(header http.Header) string {
 
-	ipPort := strings.Split(addr, ":")
-	ip = ipPort[0]
-	if len(ipPort) > 1 {
-		port = ipPort[1]
+	id := header.Get(requestid.Header)
+	if requestid.Valid(id) {
+		return id
 	}
 
-	return
+	if opts.IDGenerator != nil {
+		return opts.IDGenerator()
+	}
+	return hondo.Rand(idLen)
 }
 
 func pathQuery(url *url.URL) (path string, query map[string][]string) {
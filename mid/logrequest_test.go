@@ -97,7 +97,7 @@ var _ = Describe("LogRequest", func() {
 						"remote_ip", "10.11.12.13",
 						"remote_port", "34562",
 						"headers", http.Header{"Content-Type": []string{"application/json"}},
-						"body", `{"ima":"pc"}`,
+						"body", map[string]any{"ima": "pc"},
 					}))
 
 					body, err := io.ReadAll(received.Body)
@@ -126,11 +126,51 @@ var _ = Describe("LogRequest", func() {
 								"Content-Type":          []string{"application/json"},
 								"X-Authorization-Token": []string{"--redacted--"},
 							},
-							"body", `{"ima":"pc"}`,
+							"body", map[string]any{"ima": "pc"},
 						}))
 					})
 				})
 
+				When("and query and path are redacted per logging options", func() {
+					BeforeEach(func() {
+						request, _ = http.NewRequest("GET", "http://boxworld.net/reset/abc123?access_token=secret&ima=pc", nil)
+						lg := NewLogging(lgr, WithRedactQuery("access_token"), WithMaskRoutes("GET /reset/{token}"))
+						handler = lg.LogRequest(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+							received = request
+						}))
+					})
+
+					It("logs them redacted and the request is intact", func() {
+						ic := lgr.TraceCalls()
+						Expect(ic).To(HaveLen(1))
+						Expect(ic[0].Kv).To(ContainElements(
+							"path", "/reset/--redacted--",
+							"query", map[string][]string{"access_token": {"--redacted--"}, "ima": {"pc"}},
+						))
+
+						Expect(received.URL.Path).To(Equal("/reset/abc123"))
+						Expect(received.URL.Query().Get("access_token")).To(Equal("secret"))
+					})
+				})
+
+				When("and the logger reports trace is not enabled", func() {
+					BeforeEach(func() {
+						handler = LogRequest(&enablerMock{LoggerMock: lgr}, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+							received = request
+						}))
+					})
+
+					It("adds request_id but does not log and body is intact", func() {
+						Expect(lgr.TraceCalls()).To(BeEmpty())
+						Expect(lgr.WithFieldsCalls()).To(HaveLen(1))
+
+						body, err := io.ReadAll(received.Body)
+						received.Body.Close()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(string(body)).To(Equal(`{"ima":"pc"}`))
+					})
+				})
+
 				When("and body skipping is enabled", func() {
 					BeforeEach(func() {
 						SkipBody = true
@@ -162,4 +202,78 @@ var _ = Describe("LogRequest", func() {
 
 		})
 	})
+
+	Describe("propagating the request id", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+			opts     []Option
+			id       string
+		)
+
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/", nil)
+			recorder = httptest.NewRecorder()
+			opts = nil
+		})
+
+		JustBeforeEach(func() {
+			handler = NewLogging(lgr, opts...).LogRequest(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				id = RequestID(request.Context())
+			}))
+			handler.ServeHTTP(recorder, request)
+		})
+
+		When("the client does not send one", func() {
+			It("generates, stores, logs, and echoes one", func() {
+				Expect(id).To(HaveLen(idLen))
+				Expect(recorder.Header().Get("X-Request-Id")).To(Equal(id))
+
+				wfc := lgr.WithFieldsCalls()
+				Expect(wfc).To(HaveLen(1))
+				Expect(wfc[0].Kv).To(HaveExactElements([]any{"request_id", id}))
+			})
+		})
+
+		When("the client sends a valid one", func() {
+			BeforeEach(func() {
+				request.Header.Set("X-Request-Id", "0190b5c2-6c7e-7a3b-8f1e-3c2d1e0f9a8b")
+			})
+
+			It("is honored", func() {
+				Expect(id).To(Equal("0190b5c2-6c7e-7a3b-8f1e-3c2d1e0f9a8b"))
+				Expect(recorder.Header().Get("X-Request-Id")).To(Equal(id))
+			})
+		})
+
+		When("the client sends an invalid one", func() {
+			BeforeEach(func() {
+				request.Header.Set("X-Request-Id", "ima pc; drop table")
+			})
+
+			It("is replaced", func() {
+				Expect(id).To(HaveLen(idLen))
+				Expect(recorder.Header().Get("X-Request-Id")).To(Equal(id))
+			})
+		})
+
+		When("a generator is given", func() {
+			BeforeEach(func() {
+				opts = []Option{WithIDGenerator(func() string { return "ima-generated-id" })}
+			})
+
+			It("is used", func() {
+				Expect(id).To(Equal("ima-generated-id"))
+				Expect(recorder.Header().Get("X-Request-Id")).To(Equal(id))
+			})
+		})
+	})
 })
+
+type enablerMock struct {
+	*LoggerMock
+	enabled bool
+}
+
+func (em *enablerMock) Enabled(ctx context.Context, level string) bool {
+	return em.enabled
+}
@@ -1,49 +1,207 @@
 package mid
 
 import (
-	"bytes"
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/clarktrimble/delish/buffered"
 	"github.com/clarktrimble/delish/logger"
+	"github.com/pkg/errors"
 )
 
-// LogResponse is a middleware which logs the response
+// LogResponse is a middleware which logs the response, configured by package vars.
+//
+// When the handler flushes, the response is streamed through and
+// the body logged is the prefix buffered ahead of the first flush.
+// Likewise, once BufferLimit is exceeded, with the prefix marked truncated.
+// Nothing is buffered when the logger reports trace is not enabled.
+// Headers, such as Set-Cookie, are redacted as with LogRequest.
+// When sampling, the response is logged only when selected, see Sampler.
+// When routed by http.ServeMux, the matched pattern and path values are logged as route and path_values.
+// See also Logging.LogResponse.
 func LogResponse(lgr logger.Logger, next http.Handler) http.HandlerFunc {
 
+	return logResponse(lgr, globalOptions, next)
+}
+
+// LogStreaming is a middleware which logs the response without buffering, configured by package vars.
+//
+// Status, bytes, time to first byte, and any write error are logged, and never the body.
+// See also Logging.LogStreaming.
+func LogStreaming(lgr logger.Logger, next http.Handler) http.HandlerFunc {
+
+	return logStreaming(lgr, globalOptions, next)
+}
+
+// unexported
+
+func logResponse(lgr logger.Logger, options func() *Options, next http.Handler) http.HandlerFunc {
+
 	return func(writer http.ResponseWriter, request *http.Request) {
 
-		if skipLogging(request) {
+		ctx := request.Context()
+		opts := options()
+		if opts.skipLogging(request) || !logger.Enabled(ctx, lgr, traceLevel) {
 			next.ServeHTTP(writer, request)
 			return
 		}
 
+		if opts.streamsPath(request) {
+			opts.stream(lgr, writer, request, next)
+			return
+		}
+
 		start := time.Now()
-		ctx := request.Context()
-		buf := &buffered.Buffered{
-			Writer: writer,
-			Buffer: bytes.Buffer{},
+		buf := buffered.Get(writer, opts.BufferLimit)
+		defer buf.Release()
+
+		// measure beneath the buffer, in case it passes through by content type
+		var str *Streaming
+		if len(opts.StreamTypes) > 0 {
+			str = NewStreaming(writer)
+			buf.Writer = str
+			buf.Stream = opts.streamsType
 		}
 
 		next.ServeHTTP(buf, request)
+		elapsed := time.Since(start)
+
+		reason := ""
+		if opts.Sampler != nil {
+			reason = opts.sample(lgr, request, buf.Status, elapsed)
+			if reason == "" {
+				writeResponse(ctx, lgr, buf, str)
+				return
+			}
+		}
 
 		fields := []any{
 			"status", buf.Status,
-			"headers", buf.Header(),
-			"elapsed", time.Since(start),
+			"headers", opts.redact(buf.Header()),
+			"elapsed", elapsed,
 		}
 
-		if !SkipBody {
+		fields = append(fields, opts.routeFields(request)...)
+		if reason != "" {
+			fields = append(fields, "sample", reason)
+		}
+
+		if buf.Streamed {
+			fields = append(fields, "streamed", true, "bytes", buf.Size)
+			if str != nil {
+				fields = append(fields, "first_byte", str.FirstByte())
+			}
+		}
+		if buf.Truncated {
+			fields = append(fields, "truncated", true)
+		}
+		if buf.Hijacked {
+			fields = append(fields, "hijacked", true)
+		}
+
+		passed := buf.Streamed && buf.Buffer.Len() == 0
+		if opts.logBody(request) && !passed {
 			fields = append(fields, "body")
-			fields = append(fields, buf.Body())
+			fields = append(fields, opts.formatBody(buf.Header(), buf.Buffer.Bytes(), buf.Truncated))
 		}
 
 		lgr.Trace(ctx, "sending response", fields...)
+		writeResponse(ctx, lgr, buf, str)
+	}
+}
+
+func logStreaming(lgr logger.Logger, options func() *Options, next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		opts := options()
+		if opts.skipLogging(request) || !logger.Enabled(request.Context(), lgr, traceLevel) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		opts.stream(lgr, writer, request, next)
+	}
+}
+
+// stream serves next via Streaming and logs the outcome.
+func (opts *Options) stream(lgr logger.Logger, writer http.ResponseWriter, request *http.Request, next http.Handler) {
+
+	ctx := request.Context()
+	str := NewStreaming(writer)
 
-		err := buf.WriteResponse()
-		if err != nil {
-			lgr.Error(ctx, "failed to write response", err)
+	next.ServeHTTP(str, request)
+	elapsed := time.Since(str.start)
+
+	reason := ""
+	if opts.Sampler != nil {
+		reason = opts.sample(lgr, request, str.Status(), elapsed)
+		if reason == "" {
+			streamFailed(ctx, lgr, str)
+			return
 		}
 	}
+
+	fields := []any{
+		"status", str.Status(),
+		"headers", opts.redact(str.Header()),
+		"elapsed", elapsed,
+	}
+
+	fields = append(fields, opts.routeFields(request)...)
+	if reason != "" {
+		fields = append(fields, "sample", reason)
+	}
+
+	fields = append(fields,
+		"streamed", true,
+		"bytes", str.Size(),
+		"first_byte", str.FirstByte(),
+	)
+	if str.Hijacked() {
+		fields = append(fields, "hijacked", true)
+	}
+
+	lgr.Trace(ctx, "sending response", fields...)
+	streamFailed(ctx, lgr, str)
+}
+
+// sample decides whether to log, logging any request line held for the decision.
+func (opts *Options) sample(lgr logger.Logger, request *http.Request, status int, elapsed time.Duration) (reason string) {
+
+	ctx := request.Context()
+	client := ClientIP(ctx)
+	if client == "" {
+		client, _ = ipPort(request.RemoteAddr)
+	}
+
+	reason = opts.Sampler.Decide(routeOf(request), client, status, elapsed)
+
+	smp := sampleFrom(ctx)
+	if smp != nil {
+		smp.decide(lgr, reason)
+	}
+
+	return
+}
+
+// writeResponse writes out anything buffered, logging any failure, including while passing through str.
+func writeResponse(ctx context.Context, lgr logger.Logger, buf *buffered.Buffered, str *Streaming) {
+
+	err := buf.WriteResponse()
+	if err == nil && str != nil {
+		err = str.Err()
+	}
+
+	if err != nil {
+		lgr.Error(ctx, "failed to write response", err)
+	}
+}
+
+func streamFailed(ctx context.Context, lgr logger.Logger, str *Streaming) {
+
+	if str.Err() != nil {
+		lgr.Error(ctx, "failed to write response", errors.Wrapf(str.Err(), "failed to stream response"))
+	}
 }
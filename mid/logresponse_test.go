@@ -1,10 +1,17 @@
 package mid
 
 import (
+	"bufio"
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 
+	"github.com/a-h/templ"
+	templruntime "github.com/a-h/templ/runtime"
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/respond"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -25,6 +32,7 @@ var _ = Describe("LogResponse", func() {
 		}
 
 		SkipBody = false
+		BufferLimit = 1 << 20
 	})
 
 	Describe("logging the response", func() {
@@ -43,7 +51,7 @@ var _ = Describe("LogResponse", func() {
 				Expect(ic).To(HaveLen(1))
 				Expect(ic[0].Msg).To(Equal("sending response"))
 				Expect(mapLog(ic[0].Kv)).To(Equal(map[string]any{
-					"body":    `{"ima":"pc"}`,
+					"body":    map[string]any{"ima": "pc"},
 					"elapsed": "replaced-for-unit",
 					"headers": http.Header{"Content-Type": []string{"application/json"}},
 					"status":  201,
@@ -70,8 +78,203 @@ var _ = Describe("LogResponse", func() {
 					Expect(recorder.Body.String()).To(Equal(`{"ima":"pc"}`))
 				})
 			})
+
+			When("and a response header is flagged for redaction", func() {
+				BeforeEach(func() {
+					handler = NewLogging(lgr, WithRedactHeaders("set-cookie")).LogResponse(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+						http.SetCookie(writer, &http.Cookie{Name: "session", Value: "this-is-secret"})
+						writer.WriteHeader(204)
+					}))
+				})
+
+				It("redacts that header in the logging and the response is intact", func() {
+					ic := lgr.TraceCalls()
+					Expect(ic).To(HaveLen(1))
+					Expect(ic[0].Kv).To(ContainElements("headers", http.Header{"Set-Cookie": {"--redacted--"}}))
+
+					Expect(recorder.Header().Get("Set-Cookie")).To(Equal("session=this-is-secret"))
+				})
+			})
+
+			When("and the handler streams", func() {
+				BeforeEach(func() {
+					handler = LogResponse(lgr, streamHandler("data: one\n\n", "data: two\n\n"))
+				})
+
+				It("logs the prefix, flags streamed, counts bytes, and body is intact", func() {
+					ic := lgr.TraceCalls()
+					Expect(ic).To(HaveLen(1))
+					Expect(ic[0].Msg).To(Equal("sending response"))
+					Expect(mapLog(ic[0].Kv)).To(Equal(map[string]any{
+						"body":     "data: one\n\n",
+						"bytes":    22,
+						"elapsed":  "replaced-for-unit",
+						"headers":  http.Header{"Content-Type": []string{"text/event-stream"}},
+						"status":   200,
+						"streamed": true,
+					}))
+
+					Expect(recorder.Flushed).To(BeTrue())
+					Expect(recorder.Body.String()).To(Equal("data: one\n\ndata: two\n\n"))
+				})
+			})
+
+			When("and the logger reports trace is not enabled", func() {
+				BeforeEach(func() {
+					handler = LogResponse(&enablerMock{LoggerMock: lgr}, jsonHandler(201, `{"ima":"pc"}`))
+				})
+
+				It("does not log and body is intact", func() {
+					Expect(lgr.TraceCalls()).To(BeEmpty())
+
+					Expect(recorder.Code).To(Equal(201))
+					Expect(recorder.Body.String()).To(Equal(`{"ima":"pc"}`))
+				})
+			})
+
+			When("and the response is over the buffer limit", func() {
+				BeforeEach(func() {
+					BufferLimit = 5
+				})
+
+				It("logs the truncated prefix and true size, and body is intact", func() {
+					ic := lgr.TraceCalls()
+					Expect(ic).To(HaveLen(1))
+					Expect(mapLog(ic[0].Kv)).To(Equal(map[string]any{
+						"body":      `{"ima--truncated--`,
+						"bytes":     12,
+						"elapsed":   "replaced-for-unit",
+						"headers":   http.Header{"Content-Type": []string{"application/json"}},
+						"status":    201,
+						"streamed":  true,
+						"truncated": true,
+					}))
+
+					Expect(recorder.Code).To(Equal(201))
+					Expect(recorder.Body.String()).To(Equal(`{"ima":"pc"}`))
+				})
+			})
+
+			When("and the handler renders templ with a flush", func() {
+				BeforeEach(func() {
+					handler = LogResponse(lgr, templHandler(lgr))
+				})
+
+				It("logs the prefix, flags streamed, and body is intact", func() {
+					ic := lgr.TraceCalls()
+					Expect(ic).To(HaveLen(1))
+					Expect(mapLog(ic[0].Kv)).To(Equal(map[string]any{
+						"body":     "<p>before</p>",
+						"bytes":    25,
+						"elapsed":  "replaced-for-unit",
+						"headers":  http.Header{"Content-Type": []string{"text/html"}},
+						"status":   200,
+						"streamed": true,
+					}))
+
+					Expect(recorder.Code).To(Equal(200))
+					Expect(recorder.Body.String()).To(Equal("<p>before</p><p>after</p>"))
+				})
+			})
+
+			When("and the handler renders templ without a flush", func() {
+				BeforeEach(func() {
+					handler = LogResponse(lgr, templHandler(lgr, "no flush"))
+				})
+
+				It("logs the whole body as templ flushes on release, and body is intact", func() {
+					ic := lgr.TraceCalls()
+					Expect(ic).To(HaveLen(1))
+					Expect(mapLog(ic[0].Kv)).To(HaveKeyWithValue("body", "<p>before</p><p>after</p>"))
+					Expect(mapLog(ic[0].Kv)).To(HaveKeyWithValue("streamed", true))
+
+					Expect(recorder.Body.String()).To(Equal("<p>before</p><p>after</p>"))
+				})
+			})
+		})
+
+	})
+
+	Describe("hijacking the connection", func() {
+
+		BeforeEach(func() {
+			lgr.ErrorFunc = func(ctx context.Context, msg string, err error, kv ...any) {}
+			handler = LogResponse(lgr, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				conn, rw, err := http.NewResponseController(writer).Hijack()
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				_, err = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rw.Flush()).To(Succeed())
+			}))
+		})
+
+		JustBeforeEach(func() {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			request, err := http.NewRequest("GET", server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("Connection", "Upgrade")
+			request.Header.Set("Upgrade", "websocket")
+
+			response, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			response.Body.Close()
+			Expect(response.StatusCode).To(Equal(101))
+		})
+
+		It("logs hijacked and does not fail writing the response", func() {
+			Eventually(lgr.TraceCalls).Should(HaveLen(1))
+			Expect(lgr.TraceCalls()[0].Kv).To(ContainElements("hijacked", true))
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+		})
+	})
+
+	Describe("streaming the response to a live client", func() {
+		var (
+			release chan struct{}
+			first   string
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			inner := streamHandler("data: one\n\n")
+			handler = LogResponse(lgr, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				inner(writer, request)
+				<-release
+				_, err := writer.Write([]byte("data: two\n\n"))
+				Expect(err).ToNot(HaveOccurred())
+			}))
+		})
+
+		JustBeforeEach(func() {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			response, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer response.Body.Close()
+
+			// first event arrives ahead of the handler returning
+
+			reader := bufio.NewReader(response.Body)
+			first, err = reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+
+			close(release)
+			_, err = io.ReadAll(reader)
+			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("delivers events as they are flushed and logs", func() {
+			Expect(first).To(Equal("data: one\n"))
+
+			ic := lgr.TraceCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Kv).To(ContainElements("bytes", 22))
+		})
 	})
 })
 
@@ -87,6 +290,58 @@ func jsonHandler(code int, msg string) http.HandlerFunc {
 	}
 }
 
+func streamHandler(events ...string) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		writer.Header().Set("content-type", "text/event-stream")
+		flusher, ok := writer.(http.Flusher)
+		Expect(ok).To(BeTrue())
+
+		for _, event := range events {
+			_, err := writer.Write([]byte(event))
+			Expect(err).ToNot(HaveOccurred())
+			flusher.Flush()
+		}
+	}
+}
+
+func templHandler(lgr logger.Logger, noFlush ...string) http.HandlerFunc {
+
+	// as generated by templ, buffering and flushing on release
+
+	component := templ.ComponentFunc(func(ctx context.Context, writer io.Writer) (err error) {
+
+		buf, isBuf := templruntime.GetBuffer(writer)
+		if !isBuf {
+			defer func() {
+				relErr := templruntime.ReleaseBuffer(buf)
+				if err == nil {
+					err = relErr
+				}
+			}()
+		}
+
+		_, err = buf.WriteString("<p>before</p>")
+		if err != nil {
+			return
+		}
+		if len(noFlush) == 0 {
+			err = templ.Flush().Render(ctx, buf)
+			if err != nil {
+				return
+			}
+		}
+		_, err = buf.WriteString("<p>after</p>")
+		return
+	})
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		respond.New(writer, lgr).WriteTempl(request.Context(), component)
+	}
+}
+
 func mapLog(kv []any) (mapped map[string]any) {
 
 	mapped = map[string]any{}
@@ -100,6 +355,10 @@ func mapLog(kv []any) (mapped map[string]any) {
 			Expect(val).To(BeNumerically("<", 1000000))
 			val = "replaced-for-unit"
 		}
+		if key == "first_byte" {
+			Expect(val).To(BeNumerically(">", 0))
+			val = "replaced-for-unit"
+		}
 		mapped[key] = val
 	}
 
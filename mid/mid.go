@@ -3,24 +3,58 @@ package mid
 import (
 	"net/http"
 	"regexp"
-)
 
-// Todo: canonicalize redact headers, see giant for example
-// Todo: replace pkg vars maybe with "mid.NewLogger(lgr, opts)" (sets up both)
+	"github.com/clarktrimble/delish/cors"
+)
 
+// Package vars configure LogRequest and LogResponse.
+//
+// Deprecated: they are shared process-wide, see NewLogging for per-instance options.
 var (
 	RedactHeaders = map[string]bool{}
 	SkipPattern   *regexp.Regexp
 	SkipBody      bool
+	BodyLimit     = defaultBodyLimit
+	BufferLimit   = defaultBufferLimit
+)
+
+const (
+	defaultBufferLimit int    = 1 << 20
+	truncated          string = "--truncated--"
+	redacted           string = "--redacted--"
+	traceLevel         string = "trace"
 )
 
-func skipLogging(request *http.Request) bool {
+// globalOptions gathers package vars, as of each request.
+func globalOptions() *Options {
+
+	return &Options{
+		RedactHeaders: RedactHeaders,
+		SkipPattern:   SkipPattern,
+		SkipBody:      SkipBody,
+		BodyLimit:     BodyLimit,
+		BufferLimit:   BufferLimit,
+	}
+}
+
+func (opts *Options) logBody(request *http.Request) bool {
+
+	return !opts.SkipBody ||
+		opts.BodyPattern != nil &&
+			request.URL != nil &&
+			opts.BodyPattern.MatchString(request.URL.Path)
+}
+
+func (opts *Options) skipLogging(request *http.Request) bool {
 
-	// Todo: unit
 	// Todo: log just a little? body is really the heavy lift here
 	// lgr.Trace(ctx, "streaming response", "path", request.URL.Path, "elapsed", time.Since(start))
 
-	return SkipPattern != nil &&
+	if opts.SkipPreflight && cors.Preflight(request) {
+		return true
+	}
+
+	return opts.SkipPattern != nil &&
 		request.URL != nil &&
-		SkipPattern.MatchString(request.URL.Path)
+		opts.SkipPattern.MatchString(request.URL.Path)
 }
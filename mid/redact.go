@@ -0,0 +1,305 @@
+package mid
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fieldPath is a compiled redact field such as "password", "$.user.password", or "$..token".
+//
+// A bare name matches at any depth, as with "$..name".
+// Arrays are traversed transparently and "*" matches any one key.
+type fieldPath []segment
+
+type segment struct {
+	name string
+	deep bool
+}
+
+func compileFields(fields []string) (paths []fieldPath) {
+
+	for _, field := range fields {
+		paths = append(paths, compileField(field))
+	}
+
+	return
+}
+
+func compileField(field string) (path fieldPath) {
+
+	if !strings.HasPrefix(field, "$") {
+		return fieldPath{{name: field, deep: true}}
+	}
+
+	field = strings.TrimPrefix(strings.ReplaceAll(field[1:], "[*]", ""), ".")
+	deep := false
+
+	for _, name := range strings.Split(field, ".") {
+		if name == "" {
+			// empty between dots is recursive descent
+			deep = true
+			continue
+		}
+
+		path = append(path, segment{name: name, deep: deep})
+		deep = false
+	}
+
+	return
+}
+
+func (path fieldPath) match(keys []string) bool {
+
+	if len(path) == 0 {
+		return len(keys) == 0
+	}
+	if len(keys) == 0 {
+		return false
+	}
+
+	seg := path[0]
+	if !seg.deep {
+		return seg.matches(keys[0]) && path[1:].match(keys[1:])
+	}
+
+	for i := range keys {
+		if seg.matches(keys[i]) && path[1:].match(keys[i+1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (seg segment) matches(key string) bool {
+
+	return seg.name == "*" || strings.EqualFold(seg.name, key)
+}
+
+func (opts *Options) redactKey(keys []string) bool {
+
+	for _, path := range opts.redactPaths {
+		if path.match(keys) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactJson redacts fields in place, in parsed json.
+func (opts *Options) redactJson(val any, keys []string) any {
+
+	switch typed := val.(type) {
+	case map[string]any:
+		for key, inner := range typed {
+			path := append(keys[:len(keys):len(keys)], key)
+			if opts.redactKey(path) {
+				typed[key] = redacted
+				continue
+			}
+			typed[key] = opts.redactJson(inner, path)
+		}
+	case []any:
+		for i, inner := range typed {
+			typed[i] = opts.redactJson(inner, keys)
+		}
+	}
+
+	return val
+}
+
+// redactForm redacts fields in place, as top-level keys.
+func (opts *Options) redactForm(values url.Values) url.Values {
+
+	for key := range values {
+		if opts.redactKey([]string{key}) {
+			values[key] = []string{redacted}
+		}
+	}
+
+	return values
+}
+
+// redactQuery redacts query parameters in place, matching names as case-insensitive globs.
+func (opts *Options) redactQuery(query map[string][]string) map[string][]string {
+
+	if len(opts.RedactQuery) == 0 {
+		return query
+	}
+
+	for key := range query {
+		if matchAny(opts.RedactQuery, key) {
+			query[key] = []string{redacted}
+		}
+	}
+
+	return query
+}
+
+// redact copies header for logging, keeping only AllowHeaders when given and redacting per RedactHeaders.
+func (opts *Options) redact(header http.Header) (clean http.Header) {
+
+	if header == nil {
+		return
+	}
+
+	clean = make(http.Header, len(header))
+	for key, vals := range header {
+		switch {
+		case len(opts.AllowHeaders) > 0 && !matchAny(opts.AllowHeaders, key):
+			continue
+		case opts.redactHeader(key):
+			clean[key] = []string{redacted}
+		default:
+			clean[key] = append([]string(nil), vals...)
+		}
+	}
+
+	return
+}
+
+func (opts *Options) redactHeader(key string) bool {
+
+	if opts.RedactHeaders[key] {
+		return true
+	}
+
+	// names may be non-canonical or globs, as when set via package var
+	for name, ok := range opts.RedactHeaders {
+		if ok && matchName(name, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+
+	for _, pattern := range patterns {
+		if matchName(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchName matches name against a case-insensitive glob, such as "X-*-Token".
+func matchName(pattern, name string) bool {
+
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
+
+func checkGlobs(lists ...[]string) (err error) {
+
+	for _, patterns := range lists {
+		for _, pattern := range patterns {
+			_, err = path.Match(pattern, "")
+			if err != nil {
+				err = errors.Wrapf(err, "failed to compile glob: %s", pattern)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// route is a compiled mask route, with wildcard segments such as "{token}" empty.
+// route is a pattern's segments, blank for a wildcard, with rest last for one such as "{path...}".
+type route []string
+
+const (
+	rest string = "{...}"
+)
+
+func compileRoutes(patterns []string) (routes []route) {
+
+	for _, pattern := range patterns {
+
+		// as with http.ServeMux, a method may lead
+		if _, after, ok := strings.Cut(pattern, " "); ok {
+			pattern = after
+		}
+
+		var rt route
+		for _, seg := range strings.Split(pattern, "/") {
+			switch {
+			case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}"):
+				seg = rest
+			case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+				seg = ""
+			}
+			rt = append(rt, seg)
+		}
+		routes = append(routes, rt)
+	}
+
+	return
+}
+
+// maskPath masks wildcard segments of the first matching route, and all those remaining for a rest wildcard.
+func (opts *Options) maskPath(logged string) string {
+
+	if len(opts.routes) == 0 {
+		return logged
+	}
+
+	segs := strings.Split(logged, "/")
+	for _, rt := range opts.routes {
+		if !rt.match(segs) {
+			continue
+		}
+
+		masked := make([]string, len(segs))
+		for i := range segs {
+			masked[i] = segs[i]
+			if rt.wild(i) && segs[i] != "" {
+				masked[i] = redacted
+			}
+		}
+		return strings.Join(masked, "/")
+	}
+
+	return logged
+}
+
+func (rt route) match(segs []string) bool {
+
+	if rt.hasRest() {
+		if len(segs) < len(rt) {
+			return false
+		}
+	} else if len(rt) != len(segs) {
+		return false
+	}
+
+	for i, seg := range rt {
+		if !rt.wild(i) && seg != segs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// wild reports whether the i'th segment is matched by a wildcard.
+func (rt route) wild(i int) bool {
+
+	if rt.hasRest() && i >= len(rt)-1 {
+		return true
+	}
+	return rt[i] == ""
+}
+
+func (rt route) hasRest() bool {
+
+	return len(rt) > 0 && rt[len(rt)-1] == rest
+}
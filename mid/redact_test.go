@@ -0,0 +1,299 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redact", func() {
+	var (
+		opts *Options
+	)
+
+	BeforeEach(func() {
+		opts = &Options{}
+	})
+
+	DescribeTable("redacting json fields",
+		func(fields []string, data string, expected any) {
+			opts.redactPaths = compileFields(fields)
+			Expect(opts.formatBody(jsonHeader(), []byte(data), false)).To(Equal(expected))
+		},
+		Entry("bare name at any depth",
+			[]string{"password"}, `{"password":"x","user":{"Password":"y","name":"z"}}`,
+			map[string]any{"password": redacted, "user": map[string]any{"Password": redacted, "name": "z"}}),
+		Entry("path from the root only",
+			[]string{"$.user.password"}, `{"password":"x","user":{"password":"y"}}`,
+			map[string]any{"password": "x", "user": map[string]any{"password": redacted}}),
+		Entry("recursive descent",
+			[]string{"$..token"}, `{"a":{"b":{"token":"x"}},"token":"y"}`,
+			map[string]any{"a": map[string]any{"b": map[string]any{"token": redacted}}, "token": redacted}),
+		Entry("through arrays",
+			[]string{"$.users[*].password"}, `{"users":[{"password":"x"},{"password":"y"}]}`,
+			map[string]any{"users": []any{map[string]any{"password": redacted}, map[string]any{"password": redacted}}}),
+		Entry("wildcard",
+			[]string{"$.*.secret"}, `{"a":{"secret":"x"},"secret":"y"}`,
+			map[string]any{"a": map[string]any{"secret": redacted}, "secret": "y"}),
+		Entry("whole object",
+			[]string{"credentials"}, `{"credentials":{"key":"x"}}`,
+			map[string]any{"credentials": redacted}),
+	)
+
+	When("redacting json over the limit", func() {
+		BeforeEach(func() {
+			opts.BodyLimit = 24
+			opts.redactPaths = compileFields([]string{"password"})
+		})
+
+		It("truncates the redacted json", func() {
+			body := opts.formatBody(jsonHeader(), []byte(`{"password":"hunter2hunter2"}`), false)
+			Expect(body).To(Equal(`{"password":"--redacted-` + truncated))
+		})
+	})
+
+	When("redacting json that cannot be parsed", func() {
+		BeforeEach(func() {
+			opts.redactPaths = compileFields([]string{"password"})
+		})
+
+		It("summarizes partial json", func() {
+			body := opts.formatBody(jsonHeader(), []byte(`{"password":"hun`), true)
+			Expect(body).To(Equal("--application/json: 16 bytes--"))
+		})
+
+		It("summarizes invalid json", func() {
+			body := opts.formatBody(jsonHeader(), []byte(`{"password":"hunter2"`), false)
+			Expect(body).To(Equal("--application/json: 21 bytes--"))
+		})
+	})
+
+	When("redacting a form", func() {
+		var (
+			header http.Header
+		)
+
+		BeforeEach(func() {
+			opts.redactPaths = compileFields([]string{"password"})
+			header = http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}}
+		})
+
+		It("redacts top-level fields", func() {
+			body := opts.formatBody(header, []byte("user=bob&password=hunter2"), false)
+			Expect(body).To(Equal("password=--redacted--&user=bob"))
+		})
+
+		It("summarizes a partial form", func() {
+			body := opts.formatBody(header, []byte("user=bob&pass"), true)
+			Expect(body).To(Equal("--application/x-www-form-urlencoded: 13 bytes--"))
+		})
+	})
+
+	When("redacting json labeled otherwise", func() {
+		BeforeEach(func() {
+			opts.redactPaths = compileFields([]string{"password"})
+		})
+
+		It("redacts json without a content type", func() {
+			body := opts.formatBody(http.Header{}, []byte(`{"user":"bob","password":"hunter2"}`), false)
+			Expect(body).To(Equal(map[string]any{"user": "bob", "password": redacted}))
+		})
+
+		It("redacts json posted as a form", func() {
+			header := http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}}
+			body := opts.formatBody(header, []byte(` {"user":"bob","password":"hunter2"}`), false)
+			Expect(body).To(Equal(map[string]any{"user": "bob", "password": redacted}))
+		})
+
+		It("summarizes partial json labeled as text", func() {
+			header := http.Header{"Content-Type": []string{"text/plain"}}
+			body := opts.formatBody(header, []byte(`{"password":"hun`), true)
+			Expect(body).To(Equal("--text/plain: 16 bytes--"))
+		})
+
+		It("summarizes other text", func() {
+			body := opts.formatBody(http.Header{}, []byte("password: hunter2"), false)
+			Expect(body).To(Equal("--unknown: 17 bytes--"))
+		})
+	})
+
+	When("redacting multipart form data", func() {
+		var (
+			header http.Header
+			data   []byte
+		)
+
+		BeforeEach(func() {
+			opts.redactPaths = compileFields([]string{"password"})
+			header, data = multipartForm()
+		})
+
+		It("logs fields structured, redacted, with files summarized", func() {
+			Expect(opts.formatBody(header, data, false)).To(Equal(map[string][]string{
+				"user":     {"bob"},
+				"password": {redacted},
+				"avatar":   {"--file bob.png: image/png, 4 bytes--"},
+			}))
+		})
+
+		It("summarizes partial data", func() {
+			body := opts.formatBody(header, data[:20], true)
+			Expect(body).To(HavePrefix("--multipart/form-data; boundary="))
+		})
+	})
+
+	DescribeTable("redacting query parameters",
+		func(names []string, query, expected map[string][]string) {
+			opts.RedactQuery = names
+			Expect(opts.redactQuery(query)).To(Equal(expected))
+		},
+		Entry("none configured",
+			nil, map[string][]string{"a": {"b"}}, map[string][]string{"a": {"b"}}),
+		Entry("by name, case-insensitive",
+			[]string{"access_token"}, map[string][]string{"Access_Token": {"x"}, "a": {"b"}},
+			map[string][]string{"Access_Token": {redacted}, "a": {"b"}}),
+		Entry("by glob",
+			[]string{"X-Amz-*", "*sig*"}, map[string][]string{"X-Amz-Credential": {"x"}, "signature": {"y", "z"}, "a": {"b"}},
+			map[string][]string{"X-Amz-Credential": {redacted}, "signature": {redacted}, "a": {"b"}}),
+		Entry("nil query",
+			[]string{"a"}, nil, nil),
+	)
+
+	DescribeTable("redacting headers",
+		func(redact map[string]bool, allow []string, header, expected http.Header) {
+			opts.RedactHeaders = redact
+			opts.AllowHeaders = allow
+			Expect(opts.redact(header)).To(Equal(expected))
+		},
+		Entry("nil header",
+			nil, nil, http.Header(nil), http.Header(nil)),
+		Entry("by canonical name",
+			map[string]bool{"Authorization": true}, nil,
+			http.Header{"Authorization": {"x"}, "Accept": {"y"}},
+			http.Header{"Authorization": {redacted}, "Accept": {"y"}}),
+		Entry("by name in any case",
+			map[string]bool{"authorization": true}, nil,
+			http.Header{"Authorization": {"x"}}, http.Header{"Authorization": {redacted}}),
+		Entry("by glob",
+			map[string]bool{"X-*-Token": true}, nil,
+			http.Header{"X-Auth-Token": {"x"}, "X-Api-Token": {"y"}, "X-Token": {"z"}},
+			http.Header{"X-Auth-Token": {redacted}, "X-Api-Token": {redacted}, "X-Token": {"z"}}),
+		Entry("allowlist only",
+			nil, []string{"content-type", "X-Request-*"},
+			http.Header{"Content-Type": {"a"}, "X-Request-Id": {"b"}, "Cookie": {"c"}},
+			http.Header{"Content-Type": {"a"}, "X-Request-Id": {"b"}}),
+		Entry("allowlist and redact",
+			map[string]bool{"Authorization": true}, []string{"Authorization", "Accept"},
+			http.Header{"Authorization": {"x"}, "Accept": {"y"}, "Cookie": {"z"}},
+			http.Header{"Authorization": {redacted}, "Accept": {"y"}}),
+	)
+
+	It("copies header values rather than sharing them", func() {
+		header := http.Header{"Accept": {"y"}}
+		opts.redact(header)["Accept"][0] = "changed"
+		Expect(header["Accept"]).To(Equal([]string{"y"}))
+	})
+
+	DescribeTable("masking route segments",
+		func(routes []string, path, expected string) {
+			opts.routes = compileRoutes(routes)
+			Expect(opts.maskPath(path)).To(Equal(expected))
+		},
+		Entry("none configured",
+			nil, "/reset/abc", "/reset/abc"),
+		Entry("wildcard segment",
+			[]string{"/reset/{token}"}, "/reset/abc", "/reset/--redacted--"),
+		Entry("with a method",
+			[]string{"POST /users/{id}/keys/{key}"}, "/users/42/keys/abc", "/users/--redacted--/keys/--redacted--"),
+		Entry("no match on literal",
+			[]string{"/reset/{token}"}, "/resets/abc", "/resets/abc"),
+		Entry("no match on length",
+			[]string{"/reset/{token}"}, "/reset/abc/def", "/reset/abc/def"),
+		Entry("first match among several",
+			[]string{"/a/{x}", "/b/{y}/c"}, "/b/abc/c", "/b/--redacted--/c"),
+		Entry("rest of the path",
+			[]string{"/files/{path...}"}, "/files/a/b", "/files/--redacted--/--redacted--"),
+		Entry("rest of the path, one segment",
+			[]string{"GET /files/{path...}"}, "/files/a", "/files/--redacted--"),
+		Entry("rest of the path, none",
+			[]string{"/files/{path...}"}, "/files/", "/files/"),
+		Entry("no match on literal before rest",
+			[]string{"/files/{path...}"}, "/images/a/b", "/images/a/b"),
+	)
+
+	Describe("logging a request with redacted fields", func() {
+		var (
+			lgr      *LoggerMock
+			recorder *httptest.ResponseRecorder
+			received string
+		)
+
+		BeforeEach(func() {
+			lgr = &LoggerMock{
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+				WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+					return ctx
+				},
+			}
+			recorder = httptest.NewRecorder()
+
+			handler := NewLogging(lgr, WithRedactFields("password")).Wrap(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				body, err := io.ReadAll(request.Body)
+				Expect(err).ToNot(HaveOccurred())
+				received = string(body)
+
+				writer.Header().Set("Content-Type", "application/json")
+				_, err = writer.Write(body)
+				Expect(err).ToNot(HaveOccurred())
+			}))
+
+			request := httptest.NewRequest("POST", "/", strings.NewReader(`{"password":"hunter2"}`))
+			request.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(recorder, request)
+		})
+
+		It("logs redacted bodies while the handler and client get them intact", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(2))
+			Expect(tc[0].Kv).To(ContainElements("body", map[string]any{"password": redacted}))
+			Expect(tc[1].Kv).To(ContainElements("body", map[string]any{"password": redacted}))
+
+			Expect(received).To(Equal(`{"password":"hunter2"}`))
+			Expect(recorder.Body.String()).To(Equal(`{"password":"hunter2"}`))
+		})
+	})
+})
+
+func jsonHeader() http.Header {
+
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
+
+func multipartForm() (header http.Header, data []byte) {
+
+	buf := &bytes.Buffer{}
+	mpw := multipart.NewWriter(buf)
+
+	Expect(mpw.WriteField("user", "bob")).To(Succeed())
+	Expect(mpw.WriteField("password", "hunter2")).To(Succeed())
+
+	part, err := mpw.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="avatar"; filename="bob.png"`},
+		"Content-Type":        {"image/png"},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	_, err = part.Write([]byte{0x89, 'P', 'N', 'G'})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(mpw.Close()).To(Succeed())
+
+	header = http.Header{"Content-Type": []string{mpw.FormDataContentType()}}
+	data = buf.Bytes()
+	return
+}
@@ -0,0 +1,127 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type routeKey struct{}
+
+// WithRoute adds a holder to ctx for the pattern matched by http.ServeMux,
+// filled by LogRequest once routed, for middleware beyond that replacing the request.
+func WithRoute(ctx context.Context) context.Context {
+
+	return context.WithValue(ctx, routeKey{}, &routeHolder{})
+}
+
+// Route gets the pattern matched by http.ServeMux for request, or else as held in its ctx, see WithRoute.
+//
+// Available once next has returned, and blank when not routed.
+func Route(request *http.Request) string {
+
+	if request.Pattern != "" {
+		return request.Pattern
+	}
+
+	holder, ok := request.Context().Value(routeKey{}).(*routeHolder)
+	if !ok {
+		return ""
+	}
+	return holder.pattern
+}
+
+// unexported
+
+type routeHolder struct {
+	pattern string
+}
+
+// holdRoute fills the holder in the request's ctx, if any, with the pattern matched.
+func holdRoute(request *http.Request) {
+
+	holder, ok := request.Context().Value(routeKey{}).(*routeHolder)
+	if ok && request.Pattern != "" {
+		holder.pattern = request.Pattern
+	}
+}
+
+// routeOf gets the pattern matched by http.ServeMux, or the path when none, for grouping by route.
+func routeOf(request *http.Request) string {
+
+	if request.Pattern != "" {
+		return request.Pattern
+	}
+	if request.URL != nil {
+		return request.URL.Path
+	}
+
+	return ""
+}
+
+// routeFields gets the matched pattern and its path values, masked as with the logged path.
+//
+// Available once next has returned, as the pattern is set on the request by http.ServeMux.
+func (opts *Options) routeFields(request *http.Request) (fields []any) {
+
+	if request.Pattern == "" {
+		return
+	}
+	fields = []any{"route", request.Pattern}
+
+	values := opts.pathValues(request)
+	if len(values) > 0 {
+		fields = append(fields, "path_values", values)
+	}
+
+	return
+}
+
+func (opts *Options) pathValues(request *http.Request) (values map[string]string) {
+
+	// as with http.ServeMux, a method and host may lead
+	pattern := request.Pattern
+	if _, after, ok := strings.Cut(pattern, " "); ok {
+		pattern = after
+	}
+	if idx := strings.Index(pattern, "/"); idx > 0 {
+		pattern = pattern[idx:]
+	}
+
+	path, _ := pathQuery(request.URL)
+	masked := strings.Split(opts.maskPath(path), "/")
+
+	for i, seg := range strings.Split(pattern, "/") {
+		name, ok := wildcard(seg)
+		if !ok {
+			continue
+		}
+
+		value := request.PathValue(name)
+		if i < len(masked) && masked[i] == redacted {
+			value = redacted
+		}
+
+		if values == nil {
+			values = map[string]string{}
+		}
+		values[name] = value
+	}
+
+	return
+}
+
+// wildcard gets the name from a pattern segment such as "{id}" or "{rest...}".
+func wildcard(seg string) (name string, ok bool) {
+
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+		return
+	}
+
+	name = strings.TrimSuffix(seg[1:len(seg)-1], "...")
+	if name == "" || name == "$" {
+		return "", false
+	}
+
+	return name, true
+}
@@ -0,0 +1,124 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route", func() {
+	var (
+		lgr     *LoggerMock
+		opts    []Option
+		path    string
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+		opts = nil
+	})
+
+	JustBeforeEach(func() {
+		rtr := http.NewServeMux()
+		rtr.HandleFunc("GET /users/{id}/files/{path...}", func(writer http.ResponseWriter, request *http.Request) {})
+		rtr.HandleFunc("POST example.com/reset/{token}", func(writer http.ResponseWriter, request *http.Request) {})
+		rtr.HandleFunc("GET /{$}", func(writer http.ResponseWriter, request *http.Request) {})
+
+		handler = NewLogging(lgr, opts...).Wrap(rtr)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	})
+
+	When("a pattern with wildcards is matched", func() {
+		BeforeEach(func() {
+			path = "/users/42/files/a/b.txt"
+		})
+
+		It("logs the pattern and path values with the response", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(2))
+			Expect(tc[0].Kv).ToNot(ContainElement("route"))
+			Expect(tc[1].Msg).To(Equal("sending response"))
+			Expect(tc[1].Kv).To(ContainElements(
+				"route", "GET /users/{id}/files/{path...}",
+				"path_values", map[string]string{"id": "42", "path": "a/b.txt"},
+			))
+		})
+	})
+
+	When("a pattern without wildcards is matched", func() {
+		BeforeEach(func() {
+			path = "/"
+		})
+
+		It("logs the pattern only", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(2))
+			Expect(tc[1].Kv).To(ContainElements("route", "GET /{$}"))
+			Expect(tc[1].Kv).ToNot(ContainElement("path_values"))
+		})
+	})
+
+	When("no pattern is matched", func() {
+		BeforeEach(func() {
+			path = "/nope"
+		})
+
+		It("logs neither", func() {
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(2))
+			Expect(tc[1].Kv).To(ContainElements("status", 404))
+			Expect(tc[1].Kv).ToNot(ContainElement("route"))
+		})
+	})
+
+	Describe("masking path values", func() {
+		var (
+			request *http.Request
+		)
+
+		BeforeEach(func() {
+			request = httptest.NewRequest(http.MethodPost, "http://example.com/reset/abc123", nil)
+			request.Pattern = "POST example.com/reset/{token}"
+			request.SetPathValue("token", "abc123")
+		})
+
+		It("gets values as is", func() {
+			Expect((&Options{}).pathValues(request)).To(Equal(map[string]string{"token": "abc123"}))
+		})
+
+		It("masks values of masked segments", func() {
+			options := &Options{routes: compileRoutes([]string{"/reset/{token}"})}
+			Expect(options.pathValues(request)).To(Equal(map[string]string{"token": "--redacted--"}))
+		})
+
+		It("masks the remainder of a masked rest wildcard", func() {
+			request = httptest.NewRequest(http.MethodGet, "/files/a/b.txt", nil)
+			request.Pattern = "GET /files/{path...}"
+			request.SetPathValue("path", "a/b.txt")
+
+			options := &Options{routes: compileRoutes([]string{"/files/{path...}"})}
+			Expect(options.pathValues(request)).To(Equal(map[string]string{"path": "--redacted--"}))
+		})
+	})
+
+	DescribeTable("finding wildcards",
+		func(seg, expected string, ok bool) {
+			name, found := wildcard(seg)
+			Expect(found).To(Equal(ok))
+			Expect(name).To(Equal(expected))
+		},
+		Entry("plain", "users", "", false),
+		Entry("named", "{id}", "id", true),
+		Entry("remainder", "{path...}", "path", true),
+		Entry("end anchor", "{$}", "", false),
+	)
+})
@@ -0,0 +1,184 @@
+package mid
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/pkg/errors"
+)
+
+// Sampler selects which requests are logged, deciding once the response is known.
+//
+// Responses other than 2xx, and those at least Slow, are always logged.
+// Others are logged with probability Rate, or that of their route in Routes,
+// keyed by mux pattern such as "GET /items/{id}" or else path.
+// ClientCap and RouteCap, when non-zero, limit these to so many per second per client ip and per route.
+type Sampler struct {
+	Rate      float64
+	Routes    map[string]float64
+	Slow      time.Duration
+	ClientCap int
+	RouteCap  int
+	mu        sync.Mutex
+	second    int64
+	counts    map[string]int
+}
+
+// SamplerSettings are Sampler as json, for adjusting at runtime.
+type SamplerSettings struct {
+	Rate      float64            `json:"rate"`
+	Routes    map[string]float64 `json:"routes"`
+	Slow      string             `json:"slow"`
+	ClientCap int                `json:"client_cap"`
+	RouteCap  int                `json:"route_cap"`
+}
+
+// WithSampler samples logging per sampler, logging every request when nil.
+func WithSampler(sampler *Sampler) Option {
+
+	return func(opts *Options) {
+		opts.Sampler = sampler
+	}
+}
+
+// Sampling reasons, as recorded in the log line.
+const (
+	sampleStatus string = "status"
+	sampleSlow   string = "slow"
+	sampleRate   string = "rate"
+)
+
+// Decide decides whether to log, giving the reason, blank when not.
+func (smp *Sampler) Decide(route, client string, status int, elapsed time.Duration) (reason string) {
+
+	switch {
+	case status != 0 && (status < 200 || status >= 300):
+		return sampleStatus
+	case smp.Slow > 0 && elapsed >= smp.Slow:
+		return sampleSlow
+	}
+
+	rate := smp.Rate
+	if routeRate, ok := smp.Routes[route]; ok {
+		rate = routeRate
+	}
+	if rate <= 0 || rate < 1 && rand.Float64() >= rate { //nolint:gosec // not for crypto
+		return
+	}
+
+	if !smp.allow(route, client) {
+		return
+	}
+
+	return sampleRate
+}
+
+// Settings gets the sampler as settings.
+func (smp *Sampler) Settings() *SamplerSettings {
+
+	settings := &SamplerSettings{
+		Rate:      smp.Rate,
+		Routes:    map[string]float64{},
+		ClientCap: smp.ClientCap,
+		RouteCap:  smp.RouteCap,
+	}
+
+	for route, rate := range smp.Routes {
+		settings.Routes[route] = rate
+	}
+	if smp.Slow > 0 {
+		settings.Slow = smp.Slow.String()
+	}
+
+	return settings
+}
+
+// New creates a Sampler from settings.
+func (settings *SamplerSettings) New() (smp *Sampler, err error) {
+
+	smp = &Sampler{
+		Rate:      settings.Rate,
+		Routes:    settings.Routes,
+		ClientCap: settings.ClientCap,
+		RouteCap:  settings.RouteCap,
+	}
+
+	if settings.Slow != "" {
+		smp.Slow, err = time.ParseDuration(settings.Slow)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse slow threshold")
+			return
+		}
+	}
+
+	return
+}
+
+// unexported
+
+// allow counts against caps within the current second.
+func (smp *Sampler) allow(route, client string) bool {
+
+	if smp.ClientCap == 0 && smp.RouteCap == 0 {
+		return true
+	}
+
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+
+	now := time.Now().Unix()
+	if now != smp.second || smp.counts == nil {
+		smp.second = now
+		smp.counts = map[string]int{}
+	}
+
+	clientKey := "client:" + client
+	routeKey := "route:" + route
+
+	if smp.ClientCap > 0 && smp.counts[clientKey] >= smp.ClientCap ||
+		smp.RouteCap > 0 && smp.counts[routeKey] >= smp.RouteCap {
+		return false
+	}
+
+	smp.counts[clientKey]++
+	smp.counts[routeKey]++
+	return true
+}
+
+type sampleKey struct{}
+
+// sample holds the request line until the sampling decision is made.
+type sample struct {
+	ctx     context.Context //nolint:containedctx // logged with later
+	fields  []any
+	decided bool
+	reason  string
+}
+
+func withSample(ctx context.Context, smp *sample) context.Context {
+
+	return context.WithValue(ctx, sampleKey{}, smp)
+}
+
+func sampleFrom(ctx context.Context) *sample {
+
+	smp, _ := ctx.Value(sampleKey{}).(*sample)
+	return smp
+}
+
+// decide records the decision, once, logging the held request line when selected.
+func (smp *sample) decide(lgr logger.Logger, reason string) {
+
+	if smp.decided {
+		return
+	}
+	smp.decided = true
+	smp.reason = reason
+
+	if reason != "" {
+		lgr.Trace(smp.ctx, "received request", append(smp.fields, "sample", reason)...)
+	}
+}
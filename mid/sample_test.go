@@ -0,0 +1,157 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sampler", func() {
+	var (
+		smp *Sampler
+	)
+
+	BeforeEach(func() {
+		smp = &Sampler{
+			Routes: map[string]float64{"GET /items/{id}": 1},
+			Slow:   time.Second,
+		}
+	})
+
+	DescribeTable("deciding",
+		func(route string, status int, elapsed time.Duration, expected string) {
+			Expect(smp.Decide(route, "10.0.0.1", status, elapsed)).To(Equal(expected))
+		},
+		Entry("ok is dropped at zero rate", "/", 200, time.Millisecond, ""),
+		Entry("unknown status is dropped at zero rate", "/", 0, time.Millisecond, ""),
+		Entry("error is always logged", "/", 500, time.Millisecond, "status"),
+		Entry("client error is always logged", "/", 404, time.Millisecond, "status"),
+		Entry("redirect is always logged", "/", 302, time.Millisecond, "status"),
+		Entry("slow is always logged", "/", 200, 2*time.Second, "slow"),
+		Entry("route rate overrides", "GET /items/{id}", 200, time.Millisecond, "rate"),
+	)
+
+	When("capped per client", func() {
+		BeforeEach(func() {
+			smp = &Sampler{Rate: 1, ClientCap: 2}
+		})
+
+		It("logs only so many per second per client, and never drops errors", func() {
+			Expect(smp.Decide("/", "10.0.0.1", 200, 0)).To(Equal("rate"))
+			Expect(smp.Decide("/", "10.0.0.1", 200, 0)).To(Equal("rate"))
+			Expect(smp.Decide("/", "10.0.0.1", 200, 0)).To(Equal(""))
+			Expect(smp.Decide("/", "10.0.0.2", 200, 0)).To(Equal("rate"))
+			Expect(smp.Decide("/", "10.0.0.1", 500, 0)).To(Equal("status"))
+		})
+	})
+
+	When("capped per route", func() {
+		BeforeEach(func() {
+			smp = &Sampler{Rate: 1, RouteCap: 1}
+		})
+
+		It("logs only so many per second per route", func() {
+			Expect(smp.Decide("/a", "10.0.0.1", 200, 0)).To(Equal("rate"))
+			Expect(smp.Decide("/a", "10.0.0.2", 200, 0)).To(Equal(""))
+			Expect(smp.Decide("/b", "10.0.0.2", 200, 0)).To(Equal("rate"))
+		})
+	})
+
+	Describe("round tripping settings", func() {
+
+		It("is as given", func() {
+			settings := &SamplerSettings{Rate: 0.5, Routes: map[string]float64{"/a": 1}, Slow: "250ms", ClientCap: 3}
+
+			smp, err := settings.New()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(smp.Slow).To(Equal(250 * time.Millisecond))
+			Expect(smp.Settings()).To(Equal(settings))
+		})
+
+		It("fails on a bad duration", func() {
+			_, err := (&SamplerSettings{Slow: "soon"}).New()
+			Expect(err).To(MatchError(ContainSubstring("failed to parse slow threshold")))
+		})
+	})
+
+	Describe("logging with a sampler", func() {
+		var (
+			lgr      *LoggerMock
+			recorder *httptest.ResponseRecorder
+			handler  http.Handler
+			status   int
+		)
+
+		BeforeEach(func() {
+			lgr = &LoggerMock{
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+				WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+					return ctx
+				},
+			}
+			recorder = httptest.NewRecorder()
+
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(status)
+				_, err := writer.Write([]byte("ima pc"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			sampler := &Sampler{Routes: map[string]float64{"GET /items/{id}": 0}}
+			handler = NewLogging(lgr, WithSampler(sampler)).Wrap(rtr)
+		})
+
+		JustBeforeEach(func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/items/42", nil))
+		})
+
+		When("the response is ok", func() {
+			BeforeEach(func() {
+				status = 200
+			})
+
+			It("logs nothing and the response is intact", func() {
+				Expect(lgr.TraceCalls()).To(BeEmpty())
+
+				Expect(recorder.Code).To(Equal(200))
+				Expect(recorder.Body.String()).To(Equal("ima pc"))
+			})
+		})
+
+		When("the response is an error", func() {
+			BeforeEach(func() {
+				status = 500
+			})
+
+			It("logs request then response, recording the decision, and the response is intact", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(2))
+				Expect(tc[0].Msg).To(Equal("received request"))
+				Expect(tc[0].Kv).To(ContainElements("path", "/items/42", "sample", "status"))
+				Expect(tc[1].Msg).To(Equal("sending response"))
+				Expect(tc[1].Kv).To(ContainElements("status", 500, "sample", "status"))
+
+				Expect(recorder.Code).To(Equal(500))
+				Expect(recorder.Body.String()).To(Equal("ima pc"))
+			})
+		})
+
+		When("only requests are logged", func() {
+			BeforeEach(func() {
+				status = 200
+				handler = NewLogging(lgr, WithSampler(&Sampler{Rate: 1})).LogRequest(http.NotFoundHandler())
+			})
+
+			It("decides without the response status", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Kv).To(ContainElements("sample", "rate"))
+			})
+		})
+	})
+})
@@ -0,0 +1,177 @@
+package mid
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// unmatched groups requests not routed by http.ServeMux.
+	unmatched string = "unmatched"
+)
+
+// Threshold is a slow request threshold, logging at info or error when at or beyond, when non-zero.
+type Threshold struct {
+	Info  time.Duration
+	Error time.Duration
+}
+
+// ThresholdSettings are Threshold as json, with durations such as "500ms".
+type ThresholdSettings struct {
+	Info  string `json:"info"`
+	Error string `json:"error"`
+}
+
+// SlowCounts are counts of slow requests, in total and by route pattern, or "unmatched".
+type SlowCounts struct {
+	Total  int64            `json:"total"`
+	Routes map[string]int64 `json:"routes"`
+}
+
+// WithSlow logs requests beyond threshold, regardless of trace.
+func WithSlow(threshold Threshold) Option {
+
+	return func(opts *Options) {
+		opts.Slow = threshold
+	}
+}
+
+// WithSlowRoute logs requests to route, a mux pattern or path, beyond threshold, overriding that of WithSlow.
+func WithSlowRoute(route string, threshold Threshold) Option {
+
+	return func(opts *Options) {
+		if opts.SlowRoutes == nil {
+			opts.SlowRoutes = map[string]Threshold{}
+		}
+		opts.SlowRoutes[route] = threshold
+	}
+}
+
+// Settings gets threshold as settings.
+func (threshold Threshold) Settings() (settings ThresholdSettings) {
+
+	if threshold.Info > 0 {
+		settings.Info = threshold.Info.String()
+	}
+	if threshold.Error > 0 {
+		settings.Error = threshold.Error.String()
+	}
+
+	return
+}
+
+// Threshold parses settings into a Threshold.
+func (settings ThresholdSettings) Threshold() (threshold Threshold, err error) {
+
+	threshold.Info, err = parseDuration(settings.Info)
+	if err != nil {
+		return
+	}
+
+	threshold.Error, err = parseDuration(settings.Error)
+	return
+}
+
+// unexported
+
+// slowCounter counts slow requests, surviving Apply.
+type slowCounter struct {
+	total  atomic.Int64
+	mu     sync.Mutex
+	routes map[string]int64
+}
+
+func (counter *slowCounter) add(route string) {
+
+	counter.total.Add(1)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	if counter.routes == nil {
+		counter.routes = map[string]int64{}
+	}
+	counter.routes[route]++
+}
+
+func (counter *slowCounter) counts() (counts SlowCounts) {
+
+	counts = SlowCounts{
+		Total:  counter.total.Load(),
+		Routes: map[string]int64{},
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	for route, count := range counter.routes {
+		counts.Routes[route] = count
+	}
+
+	return
+}
+
+func (opts *Options) detectsSlow() bool {
+
+	return opts.Slow != Threshold{} || len(opts.SlowRoutes) > 0
+}
+
+// slow logs and counts a request beyond its threshold.
+func (opts *Options) slow(lgr logger.Logger, request *http.Request, start time.Time) {
+
+	elapsed := time.Since(start)
+	route := routeOf(request)
+
+	threshold, ok := opts.SlowRoutes[route]
+	if !ok {
+		threshold = opts.Slow
+	}
+
+	over := func(limit time.Duration) bool {
+		return limit > 0 && elapsed >= limit
+	}
+	if !over(threshold.Info) && !over(threshold.Error) {
+		return
+	}
+
+	// counted by pattern alone, keeping routes bounded
+	if request.Pattern == "" {
+		route = unmatched
+	}
+	if opts.slowCounter != nil {
+		opts.slowCounter.add(route)
+	}
+
+	path, _ := pathQuery(request.URL)
+	fields := []any{
+		"method", request.Method,
+		"path", opts.maskPath(path),
+		"route", route,
+		"elapsed", elapsed,
+	}
+
+	ctx := request.Context()
+	if over(threshold.Error) {
+		err := errors.Errorf("request took %s, over threshold of %s", elapsed, threshold.Error)
+		lgr.Error(ctx, "slow request", err, append(fields, "threshold", threshold.Error)...)
+		return
+	}
+
+	lgr.Info(ctx, "slow request", append(fields, "threshold", threshold.Info)...)
+}
+
+func parseDuration(str string) (dur time.Duration, err error) {
+
+	if str == "" {
+		return
+	}
+
+	dur, err = time.ParseDuration(str)
+	err = errors.Wrapf(err, "failed to parse threshold")
+	return
+}
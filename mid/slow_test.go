@@ -0,0 +1,167 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Slow", func() {
+	var (
+		lgr     *LoggerMock
+		lg      *Logging
+		opts    []Option
+		path    string
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+		path = "/items/42"
+	})
+
+	JustBeforeEach(func() {
+		rtr := http.NewServeMux()
+		rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {})
+		rtr.HandleFunc("GET /", func(writer http.ResponseWriter, request *http.Request) {})
+
+		lg = NewLogging(&enablerMock{LoggerMock: lgr}, opts...)
+		handler = lg.Wrap(rtr)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	})
+
+	When("beyond the info threshold", func() {
+		BeforeEach(func() {
+			opts = []Option{WithSlow(Threshold{Info: time.Nanosecond, Error: time.Hour})}
+		})
+
+		It("logs at info, though trace is not enabled, and counts", func() {
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Msg).To(Equal("slow request"))
+			Expect(ic[0].Kv).To(ContainElements(
+				"method", "GET",
+				"path", "/items/42",
+				"route", "GET /items/{id}",
+				"threshold", time.Nanosecond,
+			))
+			Expect(ic[0].Kv).To(ContainElement("elapsed"))
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+
+			Expect(lg.SlowCounts()).To(Equal(SlowCounts{
+				Total:  1,
+				Routes: map[string]int64{"GET /items/{id}": 1},
+			}))
+		})
+	})
+
+	When("beyond the error threshold", func() {
+		BeforeEach(func() {
+			opts = []Option{WithSlow(Threshold{Info: time.Nanosecond, Error: time.Nanosecond})}
+		})
+
+		It("logs at error only", func() {
+			ec := lgr.ErrorCalls()
+			Expect(ec).To(HaveLen(1))
+			Expect(ec[0].Msg).To(Equal("slow request"))
+			Expect(ec[0].Err).To(MatchError(ContainSubstring("over threshold of 1ns")))
+			Expect(lgr.InfoCalls()).To(BeEmpty())
+		})
+	})
+
+	When("the route has its own threshold", func() {
+		BeforeEach(func() {
+			opts = []Option{
+				WithSlow(Threshold{Info: time.Nanosecond}),
+				WithSlowRoute("GET /items/{id}", Threshold{Info: time.Hour}),
+			}
+		})
+
+		It("overrides the global threshold", func() {
+			Expect(lgr.InfoCalls()).To(BeEmpty())
+			Expect(lg.SlowCounts().Total).To(BeZero())
+		})
+
+		When("requesting another route", func() {
+			BeforeEach(func() {
+				path = "/other"
+			})
+
+			It("uses the global threshold", func() {
+				Expect(lgr.InfoCalls()).To(HaveLen(1))
+				Expect(lg.SlowCounts().Routes).To(Equal(map[string]int64{"GET /": 1}))
+			})
+		})
+	})
+
+	When("not routed", func() {
+		BeforeEach(func() {
+			opts = []Option{WithSlow(Threshold{Info: time.Nanosecond})}
+		})
+
+		It("counts as unmatched rather than by path", func() {
+			for _, path := range []string{"/items/1", "/items/2"} {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+			}
+
+			Expect(lg.SlowCounts().Routes).To(Equal(map[string]int64{"GET /items/{id}": 1, unmatched: 2}))
+		})
+	})
+
+	When("sampling", func() {
+		BeforeEach(func() {
+			lgr.TraceFunc = func(ctx context.Context, msg string, kv ...any) {}
+			opts = []Option{
+				WithSlow(Threshold{Info: time.Nanosecond}),
+				WithSampler(&Sampler{Rate: 1}),
+			}
+		})
+
+		It("counts by the pattern set on the sampled request", func() {
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("GET /users/{id}", func(writer http.ResponseWriter, request *http.Request) {})
+
+			sampled := NewLogging(lgr, opts...)
+			for _, path := range []string{"/users/0", "/users/1"} {
+				sampled.Wrap(rtr).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			}
+
+			Expect(sampled.SlowCounts().Routes).To(Equal(map[string]int64{"GET /users/{id}": 2}))
+		})
+	})
+
+	When("no threshold is set", func() {
+		BeforeEach(func() {
+			opts = nil
+		})
+
+		It("logs and counts nothing", func() {
+			Expect(lgr.InfoCalls()).To(BeEmpty())
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+			Expect(lg.SlowCounts()).To(Equal(SlowCounts{Routes: map[string]int64{}}))
+		})
+	})
+
+	When("settings are applied", func() {
+		BeforeEach(func() {
+			opts = []Option{WithSlow(Threshold{Info: time.Nanosecond})}
+		})
+
+		It("keeps counts", func() {
+			err := lg.Apply(context.Background(), lg.Settings())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lg.SlowCounts().Total).To(Equal(int64(1)))
+		})
+	})
+})
@@ -1,30 +1,39 @@
 package mid
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 )
 
-// Todo: this might be the way re-streaming?? cleanup!
+// defaultStreamTypes are content types streamed by Logging, unless given WithStreamTypes.
+var defaultStreamTypes = []string{"text/event-stream", "application/octet-stream"}
 
-//type ResponseWriter interface {
-//Header() Header
-//Write([]byte) (int, error)
-//WriteHeader(statusCode int)
-//}
-
-// Streaming captures response meta.
+// Streaming captures response meta, passing the response straight through.
+//
+// Status, bytes written, time to first byte, and the first write error are recorded,
+// while nothing is buffered.
 type Streaming struct {
-	writer http.ResponseWriter
-	status int
-	size   int
-	err    error
+	writer   http.ResponseWriter
+	status   int
+	size     int
+	start    time.Time
+	first    time.Duration
+	written  bool
+	hijacked bool
+	err      error
 }
 
-// NewStreaming creates a Streaming.
+// NewStreaming creates a Streaming, timing from now.
 func NewStreaming(writer http.ResponseWriter) *Streaming {
+
 	return &Streaming{
 		writer: writer,
-		status: 200,
+		status: http.StatusOK,
+		start:  time.Now(),
 	}
 }
 
@@ -32,42 +41,173 @@ func NewStreaming(writer http.ResponseWriter) *Streaming {
 
 // Header returns header.
 func (str *Streaming) Header() http.Header {
+
 	return str.writer.Header()
 }
 
-// Write writes to the writer.
-func (str *Streaming) Write(body []byte) (int, error) {
-	size, err := str.writer.Write(body)
-	if err != nil {
-		str.err = err
-	}
+// Write writes to the writer, counting bytes and recording any error.
+func (str *Streaming) Write(body []byte) (count int, err error) {
+
+	str.mark()
 
-	str.size = size // Todo: wha??
-	return size, nil
+	count, err = str.writer.Write(body)
+	str.size += count
+	str.fail(err)
+	return
 }
 
-// WriteHeader stores the status code and writes headers
+// WriteHeader stores the status code and writes headers.
+//
+// Informational status codes are passed through without being stored.
 func (str *Streaming) WriteHeader(status int) {
 
-	str.status = status
+	if !informational(status) && !str.written {
+		str.status = status
+		str.mark()
+	}
+
 	str.writer.WriteHeader(status)
 }
 
 // end implement http.ResponseWriter
 
-//func (rw *responseWriter) Write(b []byte) (int, error) {
-//size, err := rw.ResponseWriter.Write(b)
-//rw.size += size
-//return size, err
-//}
+// Flush flushes the writer when supported.
+func (str *Streaming) Flush() {
+
+	_ = str.FlushError()
+}
+
+// FlushError is Flush returning an error, as preferred by http.ResponseController.
+func (str *Streaming) FlushError() (err error) {
+
+	str.mark()
+
+	return http.NewResponseController(str.writer).Flush()
+}
+
+// Hijack hands over the connection when supported by the writer.
+func (str *Streaming) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+
+	conn, rw, err = http.NewResponseController(str.writer).Hijack()
+	if err != nil {
+		return
+	}
+
+	str.hijacked = true
+	return
+}
+
+// ReadFrom passes reader through to the writer, using its ReadFrom when supported.
+func (str *Streaming) ReadFrom(reader io.Reader) (count int64, err error) {
+
+	str.mark()
+
+	readerFrom, ok := str.writer.(io.ReaderFrom)
+	if ok {
+		count, err = readerFrom.ReadFrom(reader)
+	} else {
+		count, err = io.Copy(writerOnly{str.writer}, reader)
+	}
+
+	str.size += int(count)
+	str.fail(err)
+	return
+}
+
+// Push initiates an http/2 server push when supported by the writer.
+func (str *Streaming) Push(target string, opts *http.PushOptions) error {
+
+	pusher, ok := str.writer.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+
+	return pusher.Push(target, opts)
+}
 
-// Status returns the captured status code
+// Unwrap returns the underlying writer for use by http.ResponseController.
+func (str *Streaming) Unwrap() http.ResponseWriter {
+
+	return str.writer
+}
+
+// Status returns the captured status code.
 func (str *Streaming) Status() int {
 
 	return str.status
 }
 
-// Body returns blank as streaming does not support.
-//func (str *Streaming) Body() string {
-//return ""
-//}
+// Size returns the number of body bytes written.
+func (str *Streaming) Size() int {
+
+	return str.size
+}
+
+// FirstByte returns the time from creation to headers or body first being written, zero if not yet.
+func (str *Streaming) FirstByte() time.Duration {
+
+	return str.first
+}
+
+// Err returns the first error in writing, if any.
+func (str *Streaming) Err() error {
+
+	return str.err
+}
+
+// Hijacked reports whether the connection was hijacked.
+func (str *Streaming) Hijacked() bool {
+
+	return str.hijacked
+}
+
+// unexported
+
+func (opts *Options) streamsPath(request *http.Request) bool {
+
+	return opts.StreamPattern != nil &&
+		request.URL != nil &&
+		opts.StreamPattern.MatchString(request.URL.Path)
+}
+
+// streamsType reports whether the content type in header, sans parameters, matches a stream type.
+func (opts *Options) streamsType(header http.Header) bool {
+
+	mediaType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	for _, pattern := range opts.StreamTypes {
+		if matchName(pattern, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (str *Streaming) mark() {
+
+	if str.written {
+		return
+	}
+
+	str.written = true
+	str.first = time.Since(str.start)
+}
+
+func (str *Streaming) fail(err error) {
+
+	if err != nil && str.err == nil {
+		str.err = err
+	}
+}
+
+func informational(status int) bool {
+
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// writerOnly hides any ReadFrom so io.Copy does not recurse.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,357 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streaming", func() {
+	var (
+		str *Streaming
+	)
+
+	Describe("writing", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			str = NewStreaming(recorder)
+		})
+
+		When("nothing is written", func() {
+			It("has ok status and no first byte", func() {
+				Expect(str.Status()).To(Equal(200))
+				Expect(str.Size()).To(BeZero())
+				Expect(str.FirstByte()).To(BeZero())
+			})
+		})
+
+		When("writing in chunks", func() {
+			BeforeEach(func() {
+				str.WriteHeader(202)
+				for _, chunk := range []string{"012", "3456", "789"} {
+					_, err := str.Write([]byte(chunk))
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+
+			It("accumulates bytes, keeps the final status, and marks the first byte", func() {
+				Expect(str.Status()).To(Equal(202))
+				Expect(str.Size()).To(Equal(10))
+				Expect(str.FirstByte()).To(BeNumerically(">", 0))
+				Expect(str.Err()).ToNot(HaveOccurred())
+
+				Expect(recorder.Body.String()).To(Equal("0123456789"))
+			})
+		})
+
+		When("sending an informational status first", func() {
+			var (
+				informed int
+				response *http.Response
+			)
+
+			BeforeEach(func() {
+				server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					str = NewStreaming(writer)
+					str.Header().Set("Link", "</style.css>; rel=preload")
+					str.WriteHeader(http.StatusEarlyHints)
+					str.WriteHeader(http.StatusAccepted)
+					_, err := str.Write([]byte("0123456789"))
+					Expect(err).ToNot(HaveOccurred())
+				}))
+				DeferCleanup(server.Close)
+
+				trace := &httptrace.ClientTrace{
+					Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+						informed = code
+						return nil
+					},
+				}
+				request, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", server.URL, nil)
+				Expect(err).ToNot(HaveOccurred())
+
+				response, err = server.Client().Do(request)
+				Expect(err).ToNot(HaveOccurred())
+				DeferCleanup(response.Body.Close)
+			})
+
+			It("passes it through, keeping the final status", func() {
+				Expect(informed).To(Equal(http.StatusEarlyHints))
+				Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+				Expect(str.Status()).To(Equal(http.StatusAccepted))
+
+				body, err := io.ReadAll(response.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("0123456789"))
+			})
+		})
+
+		When("writing fails", func() {
+			BeforeEach(func() {
+				str = NewStreaming(&failWriter{ResponseRecorder: recorder, after: 1})
+			})
+
+			It("returns and records the first error", func() {
+				_, err := str.Write([]byte("one"))
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = str.Write([]byte("two"))
+				Expect(err).To(MatchError("oops"))
+				_, err = str.ReadFrom(bytes.NewBufferString("three"))
+				Expect(err).To(MatchError("oops"))
+
+				Expect(str.Err()).To(MatchError("oops"))
+				Expect(str.Size()).To(Equal(3))
+			})
+		})
+	})
+
+	Describe("logging automatically", func() {
+		var (
+			lgr      *LoggerMock
+			recorder *httptest.ResponseRecorder
+			handler  http.Handler
+			path     string
+		)
+
+		BeforeEach(func() {
+			lgr = &LoggerMock{
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+				ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			}
+			recorder = httptest.NewRecorder()
+			path = "/"
+		})
+
+		JustBeforeEach(func() {
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		})
+
+		When("the content type is a stream type", func() {
+			BeforeEach(func() {
+				handler = NewLogging(lgr).LogResponse(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					writer.Header().Set("Content-Type", "application/octet-stream")
+					_, err := writer.Write([]byte("0123456789"))
+					Expect(err).ToNot(HaveOccurred())
+				}))
+			})
+
+			It("streams without buffering, logging bytes and first byte but no body", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Msg).To(Equal("sending response"))
+				Expect(tc[0].Kv).To(ContainElements("status", 200, "streamed", true, "bytes", 10, "first_byte"))
+				Expect(tc[0].Kv).ToNot(ContainElement("body"))
+				Expect(lgr.ErrorCalls()).To(BeEmpty())
+
+				Expect(recorder.Body.String()).To(Equal("0123456789"))
+			})
+		})
+
+		When("the content type is not", func() {
+			BeforeEach(func() {
+				handler = NewLogging(lgr).LogResponse(jsonHandler(201, `{"ima":"pc"}`))
+			})
+
+			It("buffers and logs the body", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Kv).To(ContainElements("body", map[string]any{"ima": "pc"}))
+				Expect(tc[0].Kv).ToNot(ContainElement("streamed"))
+			})
+		})
+
+		When("the path matches the stream pattern", func() {
+			BeforeEach(func() {
+				path = "/events/42"
+				handler = NewLogging(lgr, WithStreamPattern(regexp.MustCompile("^/events"))).
+					LogResponse(streamHandler("data: one\n\n", "data: two\n\n"))
+			})
+
+			It("streams, logging status, bytes, and first byte", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(mapLog(tc[0].Kv)).To(Equal(map[string]any{
+					"bytes":      22,
+					"elapsed":    "replaced-for-unit",
+					"first_byte": "replaced-for-unit",
+					"headers":    http.Header{"Content-Type": []string{"text/event-stream"}},
+					"status":     200,
+					"streamed":   true,
+				}))
+
+				Expect(recorder.Flushed).To(BeTrue())
+				Expect(recorder.Body.String()).To(Equal("data: one\n\ndata: two\n\n"))
+			})
+		})
+
+		When("streaming fails to write", func() {
+			BeforeEach(func() {
+				streaming := LogStreaming(lgr, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					_, _ = writer.Write([]byte("one"))
+				}))
+				handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					streaming.ServeHTTP(&failWriter{ResponseRecorder: recorder}, request)
+				})
+			})
+
+			It("logs the error", func() {
+				Expect(lgr.TraceCalls()).To(HaveLen(1))
+
+				ec := lgr.ErrorCalls()
+				Expect(ec).To(HaveLen(1))
+				Expect(ec[0].Msg).To(Equal("failed to write response"))
+				Expect(ec[0].Err).To(MatchError(ContainSubstring("failed to stream response: oops")))
+			})
+		})
+	})
+
+	Describe("passing through optional interfaces", func() {
+		var (
+			fake *fakeWriter
+		)
+
+		BeforeEach(func() {
+			fake = &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+			str = NewStreaming(fake)
+		})
+
+		It("unwraps to the writer", func() {
+			Expect(str.Unwrap()).To(Equal(fake))
+		})
+
+		It("flushes the writer", func() {
+			str.Flush()
+			Expect(fake.Flushed).To(BeTrue())
+		})
+
+		It("reads from with the writer's ReadFrom", func() {
+			count, err := str.ReadFrom(bytes.NewBufferString(`{"ima": "pc"}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(13))
+			Expect(fake.readFrom).To(BeTrue())
+			Expect(fake.Body.String()).To(Equal(`{"ima": "pc"}`))
+		})
+
+		It("pushes with the writer", func() {
+			Expect(str.Push("/style.css", nil)).To(Succeed())
+			Expect(fake.pushed).To(Equal("/style.css"))
+		})
+
+		When("the writer does not support them", func() {
+			BeforeEach(func() {
+				str = NewStreaming(httptest.NewRecorder())
+			})
+
+			It("reports not supported", func() {
+				_, _, err := str.Hijack()
+				Expect(err).To(MatchError(http.ErrNotSupported))
+				Expect(str.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+				Expect(http.NewResponseController(str).SetWriteDeadline(time.Now())).To(MatchError(http.ErrNotSupported))
+			})
+		})
+	})
+
+	Describe("serving via the stdlib server", func() {
+		var (
+			handler http.HandlerFunc
+			body    string
+		)
+
+		JustBeforeEach(func() {
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				str = NewStreaming(writer)
+				handler(str, request)
+			}))
+			defer server.Close()
+
+			response, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer response.Body.Close()
+
+			data, err := io.ReadAll(response.Body)
+			Expect(err).ToNot(HaveOccurred())
+			body = string(data)
+		})
+
+		When("the handler uses a response controller", func() {
+			BeforeEach(func() {
+				handler = func(writer http.ResponseWriter, request *http.Request) {
+					rc := http.NewResponseController(writer)
+					Expect(rc.SetWriteDeadline(time.Now().Add(time.Minute))).To(Succeed())
+					Expect(rc.SetReadDeadline(time.Now().Add(time.Minute))).To(Succeed())
+
+					_, err := writer.Write([]byte("one"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rc.Flush()).To(Succeed())
+				}
+			})
+
+			It("reaches the underlying writer", func() {
+				Expect(body).To(Equal("one"))
+			})
+		})
+
+		When("the handler hijacks the connection", func() {
+			BeforeEach(func() {
+				handler = func(writer http.ResponseWriter, request *http.Request) {
+					conn, rw, err := writer.(http.Hijacker).Hijack() //nolint:forcetypeassert // panic ok in test
+					Expect(err).ToNot(HaveOccurred())
+					defer conn.Close()
+
+					_, err = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 7\r\nConnection: close\r\n\r\nhijackd")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rw.Flush()).To(Succeed())
+				}
+			})
+
+			It("hands over the connection", func() {
+				Expect(body).To(Equal("hijackd"))
+			})
+		})
+	})
+})
+
+// failWriter fails writes after so many.
+type failWriter struct {
+	*httptest.ResponseRecorder
+	after int
+}
+
+func (fw *failWriter) Write(body []byte) (int, error) {
+	if fw.after == 0 {
+		return 0, errors.New("oops")
+	}
+	fw.after--
+	return fw.ResponseRecorder.Write(body)
+}
+
+type fakeWriter struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+	pushed   string
+}
+
+func (fw *fakeWriter) ReadFrom(reader io.Reader) (int64, error) {
+	fw.readFrom = true
+	return fw.Body.ReadFrom(reader)
+}
+
+func (fw *fakeWriter) Push(target string, opts *http.PushOptions) error {
+	fw.pushed = target
+	return nil
+}
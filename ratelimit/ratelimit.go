@@ -0,0 +1,229 @@
+// Package ratelimit provides token bucket rate limiting middleware, responding 429 to those over their limit.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clarktrimble/delish/auth"
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/mid"
+	"github.com/clarktrimble/delish/respond"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ByIP keys limits by client ip.
+	ByIP string = "ip"
+	// ByIdentity keys limits by authenticated identity, or client ip for those without.
+	ByIdentity string = "identity"
+
+	defaultRate      float64 = 10
+	defaultBurst     int     = 20
+	defaultMaxKeys   int     = 10000
+	defaultLogSample int     = 100
+)
+
+var (
+	errLimited = errors.New("rate limit exceeded")
+)
+
+// Limit is a token bucket refilling at Rate per second up to Burst.
+type Limit struct {
+	Rate  float64 `json:"rate" desc:"requests per second"`
+	Burst int     `json:"burst" desc:"requests allowed at once"`
+}
+
+// Config is the rate limiting configuration.
+type Config struct {
+	Rate      float64          `json:"rate" desc:"requests per second allowed per key" default:"10"`
+	Burst     int              `json:"burst" desc:"requests allowed at once per key" default:"20"`
+	KeyBy     string           `json:"key_by" desc:"key limits by ip or identity" default:"ip"`
+	Routes    map[string]Limit `json:"routes" desc:"limits by route pattern, such as {\"POST /items\":{\"rate\":1,\"burst\":5}}"`
+	MaxKeys   int              `json:"max_keys" desc:"keys tracked, forgetting the least recently seen beyond" default:"10000"`
+	LogSample int              `json:"log_sample" desc:"log one in so many throttled requests per key" default:"100"`
+}
+
+// Limiter limits requests per key, such as client ip, with a token bucket for each.
+//
+// Requests to routes in Routes, keyed by mux pattern, draw from buckets of their own,
+// and all others from one shared bucket per key.
+// Buckets are kept for up to MaxKeys keys, forgetting the least recently seen.
+// Requests with a blank key are not limited.
+type Limiter struct {
+	Limit     Limit
+	Routes    map[string]Limit
+	LogSample int
+	Key       func(request *http.Request) string
+	Logger    logger.Logger
+	store     *store
+	clock     func() time.Time
+}
+
+// New creates a Limiter from Config.
+func (cfg *Config) New(lgr logger.Logger) (lmt *Limiter, err error) {
+
+	lmt = &Limiter{
+		Limit:     Limit{Rate: cfg.Rate, Burst: cfg.Burst},
+		Routes:    cfg.Routes,
+		LogSample: cfg.LogSample,
+		Logger:    lgr,
+		clock:     time.Now,
+	}
+
+	if lmt.Limit.Rate == 0 {
+		lmt.Limit.Rate = defaultRate
+	}
+	if lmt.Limit.Burst == 0 {
+		lmt.Limit.Burst = defaultBurst
+	}
+	if lmt.LogSample <= 0 {
+		lmt.LogSample = defaultLogSample
+	}
+
+	err = lmt.Limit.check()
+	if err != nil {
+		return
+	}
+	for pattern, limit := range lmt.Routes {
+		err = limit.check()
+		if err != nil {
+			err = errors.Wrapf(err, "bad limit for route: %s", pattern)
+			return
+		}
+	}
+
+	switch cfg.KeyBy {
+	case "", ByIP:
+		lmt.Key = ClientIP
+	case ByIdentity:
+		lmt.Key = Identity
+	default:
+		err = errors.Errorf("unknown key by: %s", cfg.KeyBy)
+		return
+	}
+
+	maxKeys := cfg.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	lmt.store = newStore(maxKeys)
+
+	return
+}
+
+// ClientIP gets the client ip as found by request logging, see mid.ClientIP, or else the remote ip.
+func ClientIP(request *http.Request) string {
+
+	ip := mid.ClientIP(request.Context())
+	if ip != "" {
+		return ip
+	}
+
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return ip
+}
+
+// Identity gets the authenticated identity, see auth.FromContext, or else ClientIP.
+func Identity(request *http.Request) string {
+
+	id := auth.FromContext(request.Context())
+	if id == nil {
+		return ClientIP(request)
+	}
+
+	return id.Method + ":" + id.Name
+}
+
+// Wrap is a middleware responding 429 to requests over their limit.
+//
+// RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset headers are added to each response,
+// and Retry-After to those limited, of which one in LogSample per key is logged, starting with the first.
+// Routes are matched by the pattern set by http.ServeMux, so wrap handlers beneath it, see Guard.
+func (lmt *Limiter) Wrap(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		key := lmt.Key(request)
+		if key == "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		route := ""
+		limit := lmt.Limit
+		if routeLimit, ok := lmt.Routes[request.Pattern]; ok {
+			route = request.Pattern
+			limit = routeLimit
+		}
+
+		taken := lmt.store.take(route+" "+key, limit, lmt.clock(), lmt.LogSample)
+
+		header := writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(taken.remaining))
+		header.Set("RateLimit-Reset", seconds(taken.reset))
+
+		if taken.allowed {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		ctx := request.Context()
+		header.Set("Retry-After", seconds(taken.retry))
+
+		if taken.log {
+			lmt.Logger.Info(ctx, "rate limited", "limit_key", key, "retry_after", seconds(taken.retry), "throttled", taken.throttled)
+		}
+
+		respond.New(writer, lmt.Logger).WriteError(ctx, http.StatusTooManyRequests, errLimited)
+	}
+}
+
+// Router specifies a router interface à la stdlib http.ServeMux.
+type Router interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Guard gets a Router registering handlers with rtr behind Wrap.
+//
+// Guards nearer rtr run first, so when keying by identity, guard with auth beneath, as in lmt.Guard(ath.Guard(rtr)).
+func (lmt *Limiter) Guard(rtr Router) Router {
+
+	return &limited{
+		rtr: rtr,
+		lmt: lmt,
+	}
+}
+
+// unexported
+
+type limited struct {
+	rtr Router
+	lmt *Limiter
+}
+
+func (lmtd *limited) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+
+	lmtd.rtr.HandleFunc(pattern, lmtd.lmt.Wrap(http.HandlerFunc(handler)))
+}
+
+func (limit Limit) check() (err error) {
+
+	if limit.Rate <= 0 || limit.Burst < 1 {
+		err = errors.Errorf("rate must be positive and burst at least one, got: %g and %d", limit.Rate, limit.Burst)
+	}
+	return
+}
+
+// seconds formats a duration as whole seconds, rounding up.
+func seconds(dur time.Duration) string {
+
+	return strconv.Itoa(int(math.Ceil(dur.Seconds())))
+}
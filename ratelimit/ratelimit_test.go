@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clarktrimble/delish/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate moq -pkg ratelimit -out mock_test.go ../logger Logger
+
+func TestRateLimit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RateLimit Suite")
+}
+
+var _ = Describe("Limiter", func() {
+	var (
+		lgr *LoggerMock
+		cfg *Config
+		lmt *Limiter
+		rtr *http.ServeMux
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+
+		cfg = &Config{
+			Rate:  1,
+			Burst: 2,
+			Routes: map[string]Limit{
+				"POST /items": {Rate: 0.5, Burst: 1},
+			},
+		}
+
+		now = time.Unix(1700000000, 0)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		lmt, err = cfg.New(lgr)
+		Expect(err).ToNot(HaveOccurred())
+		lmt.clock = func() time.Time { return now }
+
+		rtr = http.NewServeMux()
+		limited := lmt.Guard(rtr)
+		for _, pattern := range []string{"GET /items", "GET /items/{id}", "POST /items"} {
+			limited.HandleFunc(pattern, func(writer http.ResponseWriter, request *http.Request) {})
+		}
+	})
+
+	// serve serves a request from remote via rtr
+	serve := func(method, path, remote string) *httptest.ResponseRecorder {
+
+		request := httptest.NewRequest(method, path, nil)
+		request.RemoteAddr = remote + ":4711"
+
+		recorder := httptest.NewRecorder()
+		rtr.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	It("allows a burst, then responds 429 with json and headers", func() {
+		recorder := serve("GET", "/items", "10.0.0.1")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("RateLimit-Limit")).To(Equal("2"))
+		Expect(recorder.Header().Get("RateLimit-Remaining")).To(Equal("1"))
+		Expect(recorder.Header().Get("RateLimit-Reset")).To(Equal("1"))
+
+		recorder = serve("GET", "/items/42", "10.0.0.1")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+		Expect(recorder.Header().Get("RateLimit-Reset")).To(Equal("2"))
+
+		recorder = serve("GET", "/items", "10.0.0.1")
+		Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(recorder.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+		Expect(body(recorder)).To(Equal(map[string]any{"error": "rate limit exceeded"}))
+		Expect(lgr.ErrorCalls()).To(BeEmpty())
+
+		recorder = serve("GET", "/items", "10.0.0.2")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("refills over time", func() {
+		for range 2 {
+			Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+		}
+		Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusTooManyRequests))
+
+		now = now.Add(1500 * time.Millisecond)
+		Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+		recorder := serve("GET", "/items", "10.0.0.1")
+		Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("1"))
+	})
+
+	It("limits routes by their own buckets", func() {
+		Expect(serve("POST", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+		recorder := serve("POST", "/items", "10.0.0.1")
+		Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(recorder.Header().Get("RateLimit-Limit")).To(Equal("1"))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("2"))
+
+		Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+	})
+
+	When("sampling throttling logs", func() {
+		BeforeEach(func() {
+			cfg.LogSample = 3
+		})
+
+		It("logs one in so many per key, starting with the first", func() {
+			for range 9 {
+				serve("GET", "/items", "10.0.0.1")
+			}
+			serve("GET", "/items", "10.0.0.2")
+
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(3))
+			Expect(ic[0].Msg).To(Equal("rate limited"))
+			Expect(ic[0].Kv).To(Equal([]any{"limit_key", "10.0.0.1", "retry_after", "1", "throttled", 1}))
+			Expect(ic[1].Kv).To(Equal([]any{"limit_key", "10.0.0.1", "retry_after", "1", "throttled", 4}))
+			Expect(ic[2].Kv).To(Equal([]any{"limit_key", "10.0.0.1", "retry_after", "1", "throttled", 7}))
+		})
+	})
+
+	When("keys are more than kept", func() {
+		BeforeEach(func() {
+			cfg.MaxKeys = 2
+		})
+
+		It("forgets the least recently seen", func() {
+			for _, remote := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+				serve("GET", "/items", remote)
+			}
+
+			Expect(serve("GET", "/items", "10.0.0.2").Header().Get("RateLimit-Remaining")).To(Equal("1"))
+			Expect(serve("GET", "/items", "10.0.0.1").Header().Get("RateLimit-Remaining")).To(Equal("1"))
+			Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	When("keying by identity beneath auth", func() {
+		BeforeEach(func() {
+			cfg.KeyBy = ByIdentity
+		})
+
+		It("limits each identity by its own bucket", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "tokens")
+			Expect(os.WriteFile(path, []byte("builder:tok-abc\nreporter:tok-xyz\n"), 0o600)).To(Succeed())
+
+			ath, err := (&auth.Config{TokenFile: path}).New(lgr)
+			Expect(err).ToNot(HaveOccurred())
+
+			rtr = http.NewServeMux()
+			lmt.Guard(ath.Guard(rtr)).HandleFunc("GET /reports", func(writer http.ResponseWriter, request *http.Request) {})
+
+			get := func(token string) int {
+				request := httptest.NewRequest("GET", "/reports", nil)
+				request.RemoteAddr = "10.0.0.1:4711"
+				request.Header.Set("Authorization", "Bearer "+token)
+
+				recorder := httptest.NewRecorder()
+				rtr.ServeHTTP(recorder, request)
+				return recorder.Code
+			}
+
+			for range 2 {
+				Expect(get("tok-abc")).To(Equal(http.StatusOK))
+			}
+			Expect(get("tok-abc")).To(Equal(http.StatusTooManyRequests))
+			Expect(get("tok-xyz")).To(Equal(http.StatusOK))
+
+			ic := lgr.InfoCalls()
+			Expect(ic).To(HaveLen(1))
+			Expect(ic[0].Kv[1]).To(Equal("bearer:builder"))
+		})
+	})
+
+	Describe("keying", func() {
+		It("keys by identity when found, else ip", func() {
+			request := httptest.NewRequest("GET", "/items", nil)
+			request.RemoteAddr = "10.0.0.1:4711"
+			Expect(Identity(request)).To(Equal("10.0.0.1"))
+
+			ctx := auth.With(request.Context(), &auth.Identity{Name: "reporter", Method: auth.Bearer})
+			Expect(Identity(request.WithContext(ctx))).To(Equal("bearer:reporter"))
+		})
+
+		It("does not limit a blank key", func() {
+			lmt.Key = func(request *http.Request) string { return request.Header.Get("X-Tenant") }
+
+			for range 3 {
+				Expect(serve("GET", "/items", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			}
+		})
+	})
+
+	DescribeTable("rejecting bad config",
+		func(cfg *Config, expected string) {
+			_, err := cfg.New(lgr)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("negative rate", &Config{Rate: -1}, "rate must be positive"),
+		Entry("bad route", &Config{Routes: map[string]Limit{"GET /items": {Rate: 1}}}, "bad limit for route: GET /items"),
+		Entry("unknown key by", &Config{KeyBy: "cookie"}, "unknown key by: cookie"),
+	)
+})
+
+func body(recorder *httptest.ResponseRecorder) (obj map[string]any) {
+
+	err := json.Unmarshal(recorder.Body.Bytes(), &obj)
+	Expect(err).ToNot(HaveOccurred())
+
+	return
+}
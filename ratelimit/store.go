@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket, along with a count of requests it has throttled.
+type bucket struct {
+	key       string
+	tokens    float64
+	last      time.Time
+	throttled int
+}
+
+// taken is the outcome of taking a token.
+type taken struct {
+	allowed   bool
+	remaining int
+	reset     time.Duration
+	retry     time.Duration
+	log       bool
+	throttled int
+}
+
+// store keeps buckets by key, forgetting the least recently used beyond max.
+type store struct {
+	max     int
+	mu      sync.Mutex
+	order   *list.List
+	buckets map[string]*list.Element
+}
+
+func newStore(maxKeys int) *store {
+
+	return &store{
+		max:     maxKeys,
+		order:   list.New(),
+		buckets: map[string]*list.Element{},
+	}
+}
+
+// take takes a token from the bucket for key, refilled as of now.
+//
+// Throttling is to be logged for one in sample of those throttled, starting with the first.
+func (st *store) take(key string, limit Limit, now time.Time, sample int) (tkn taken) {
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	bkt := st.get(key, limit, now)
+
+	elapsed := now.Sub(bkt.last).Seconds()
+	if elapsed > 0 {
+		bkt.tokens = min(float64(limit.Burst), bkt.tokens+elapsed*limit.Rate)
+		bkt.last = now
+	}
+
+	if bkt.tokens >= 1 {
+		bkt.tokens--
+		tkn.allowed = true
+	} else {
+		tkn.retry = perSecond(1-bkt.tokens, limit.Rate)
+
+		tkn.log = sample <= 1 || bkt.throttled%sample == 0
+		bkt.throttled++
+		tkn.throttled = bkt.throttled
+	}
+
+	tkn.remaining = int(bkt.tokens)
+	tkn.reset = perSecond(float64(limit.Burst)-bkt.tokens, limit.Rate)
+	return
+}
+
+// get gets the bucket for key, creating it full when not found.
+func (st *store) get(key string, limit Limit, now time.Time) *bucket {
+
+	elem, ok := st.buckets[key]
+	if ok {
+		st.order.MoveToFront(elem)
+		return elem.Value.(*bucket) //nolint:forcetypeassert // only buckets are stored
+	}
+
+	bkt := &bucket{key: key, tokens: float64(limit.Burst), last: now}
+	st.buckets[key] = st.order.PushFront(bkt)
+
+	for st.order.Len() > st.max {
+		oldest := st.order.Back()
+		st.order.Remove(oldest)
+		delete(st.buckets, oldest.Value.(*bucket).key) //nolint:forcetypeassert // only buckets are stored
+	}
+
+	return bkt
+}
+
+// perSecond gets the time for tokens at rate per second.
+func perSecond(tokens, rate float64) time.Duration {
+
+	return time.Duration(tokens / rate * float64(time.Second))
+}
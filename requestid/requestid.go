@@ -0,0 +1,72 @@
+// Package requestid carries a request id in the context, for correlating logs with clients and gateways.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// Header is the request and response header carrying the id.
+	Header string = "X-Request-Id"
+	// MaxLen is the longest incoming id honored.
+	MaxLen int = 64
+)
+
+type ctxKey struct{}
+
+// Generator generates a request id.
+type Generator func() string
+
+// With adds id to ctx.
+func With(ctx context.Context, id string) context.Context {
+
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// Get gets id from ctx, blank when not found.
+func Get(ctx context.Context) string {
+
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Valid checks that an incoming id is of sane length and characters.
+//
+// Letters, digits, and "-_.:=+/" are allowed, covering uuids, ulids, and the like.
+func Valid(id string) bool {
+
+	if len(id) == 0 || len(id) > MaxLen {
+		return false
+	}
+
+	for _, char := range id {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '-', char == '_', char == '.', char == ':', char == '=', char == '+', char == '/':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// UUIDv7 generates a time-sortable uuid per RFC 9562.
+func UUIDv7() string {
+
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[6:]) // never errors, per crypto/rand
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli())) //nolint:gosec // positive for some time yet
+	copy(uuid[:6], ms[2:])
+
+	uuid[6] = uuid[6]&0x0f | 0x70 // version 7
+	uuid[8] = uuid[8]&0x3f | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
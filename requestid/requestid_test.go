@@ -0,0 +1,65 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRequestId(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RequestId Suite")
+}
+
+var _ = Describe("RequestId", func() {
+
+	Describe("storing in the context", func() {
+
+		It("gets what was stored", func() {
+			Expect(Get(With(context.Background(), "abc123"))).To(Equal("abc123"))
+		})
+
+		It("gets blank when nothing was stored", func() {
+			Expect(Get(context.Background())).To(Equal(""))
+		})
+	})
+
+	DescribeTable("validating an incoming id",
+		func(id string, expected bool) {
+			Expect(Valid(id)).To(Equal(expected))
+		},
+		Entry("blank", "", false),
+		Entry("hondo", "GIehp1s", true),
+		Entry("uuid", "0190b5c2-6c7e-7a3b-8f1e-3c2d1e0f9a8b", true),
+		Entry("ulid", "01ARZ3NDEKTSV4RRFFQ69G5FAV", true),
+		Entry("amzn trace", "Root=1-67891233-abcdef012345678912345678", true),
+		Entry("too long", strings.Repeat("a", MaxLen+1), false),
+		Entry("just long enough", strings.Repeat("a", MaxLen), true),
+		Entry("space", "ima pc", false),
+		Entry("newline", "ima\npc", false),
+		Entry("quote", `ima"pc`, false),
+	)
+
+	Describe("generating a uuid v7", func() {
+		var (
+			first  string
+			second string
+		)
+
+		BeforeEach(func() {
+			first = UUIDv7()
+			time.Sleep(2 * time.Millisecond)
+			second = UUIDv7()
+		})
+
+		It("is well formed, valid, and sortable by time", func() {
+			Expect(first).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			Expect(Valid(first)).To(BeTrue())
+			Expect(first < second).To(BeTrue())
+		})
+	})
+})
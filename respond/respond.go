@@ -9,6 +9,7 @@ import (
 
 	"github.com/a-h/templ"
 	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/requestid"
 	"github.com/pkg/errors"
 )
 
@@ -38,12 +39,24 @@ func (rp *Respond) Ok(ctx context.Context) {
 }
 
 // NotOk logs an error and responds with it.
+//
+// The request id is included, when found in ctx, for reference in bug reports.
 func (rp *Respond) NotOk(ctx context.Context, code int, err error) {
 
+	rp.Logger.Error(ctx, "returning error to client", err)
+	rp.WriteError(ctx, code, err)
+}
+
+// WriteError responds with an error, as with NotOk, but without logging, for those logging their own way.
+func (rp *Respond) WriteError(ctx context.Context, code int, err error) {
+
 	rp.jsonHeader(code)
 
-	rp.Logger.Error(ctx, "returning error to client", err)
-	rp.WriteObjects(ctx, map[string]any{"error": err.Error()})
+	objects := map[string]any{"error": err.Error()}
+	if id := requestid.Get(ctx); id != "" {
+		objects["request_id"] = id
+	}
+	rp.WriteObjects(ctx, objects)
 }
 
 // GoNoGo calls NotOk or Ok.
@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/clarktrimble/delish/requestid"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -82,6 +84,33 @@ var _ = Describe("Respond(ing)", func() {
 				Expect(ec[0].Err.Error()).To(Equal("oops"))
 			})
 		})
+
+		When("a request id is in the context", func() {
+			BeforeEach(func() {
+				ctx = requestid.With(ctx, "abc123")
+				code = 400
+				err = fmt.Errorf("oops")
+			})
+
+			It("includes it in the error body", func() {
+
+				Expect(writer.Code).To(Equal(400))
+				Expect(writer.Body.String()).To(MatchJSON(`{"error":"oops","request_id":"abc123"}`))
+			})
+		})
+	})
+
+	Describe("writing an error", func() {
+
+		It("responds with http status and error body, without logging", func() {
+			ctx = requestid.With(ctx, "abc123")
+			rp.WriteError(ctx, 429, fmt.Errorf("slow down"))
+
+			Expect(writer.Code).To(Equal(429))
+			Expect(writer.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(writer.Body.String()).To(MatchJSON(`{"error":"slow down","request_id":"abc123"}`))
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+		})
 	})
 
 	Describe("with not found", func() {
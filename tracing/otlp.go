@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	scopeName   string = "github.com/clarktrimble/delish/tracing"
+	statusOk    int    = 1
+	statusError int    = 2
+)
+
+// OTLP/JSON encoding, see opentelemetry-proto's trace.proto and its json mapping
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Flags             int            `json:"flags"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func (tr *Tracer) post(ctx context.Context, spans []*Span) (err error) {
+
+	data, err := json.Marshal(tr.encode(spans))
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode spans")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tr.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create export request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := tr.Client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "failed to post spans to: %s", tr.Endpoint)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("collector at %s responded with status: %d", tr.Endpoint, response.StatusCode)
+	}
+
+	return
+}
+
+func (tr *Tracer) encode(spans []*Span) otlpRequest {
+
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, span.encode())
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{keyValue("service.name", tr.ServiceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func (span *Span) encode() (encoded otlpSpan) {
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	encoded = otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		TraceState:        span.State,
+		Flags:             int(span.Flags),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        []otlpKeyValue{},
+		Status:            otlpStatus{Code: statusOk},
+	}
+
+	if span.ParentID != (SpanID{}) {
+		encoded.ParentSpanID = span.ParentID.String()
+	}
+	if span.Error {
+		encoded.Status.Code = statusError
+	}
+
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		encoded.Attributes = append(encoded.Attributes, keyValue(key, span.Attributes[key]))
+	}
+
+	return
+}
+
+func keyValue(key string, val any) (kv otlpKeyValue) {
+
+	kv.Key = key
+
+	switch typed := val.(type) {
+	case string:
+		kv.Value.StringValue = &typed
+	case bool:
+		kv.Value.BoolValue = &typed
+	case int:
+		str := strconv.Itoa(typed)
+		kv.Value.IntValue = &str
+	case int64:
+		str := strconv.FormatInt(typed, 10)
+		kv.Value.IntValue = &str
+	case float64:
+		kv.Value.DoubleValue = &typed
+	default:
+		str := fmt.Sprintf("%v", typed)
+		kv.Value.StringValue = &str
+	}
+
+	return
+}
@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceparentHeader string = "traceparent"
+	tracestateHeader  string = "tracestate"
+	maxTracestate     int    = 512
+	sampledFlag       byte   = 0x01
+)
+
+// Kind is the span kind, as with OTLP.
+type Kind int
+
+// Span kinds.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+// String renders id as hex.
+func (id TraceID) String() string {
+
+	return hex.EncodeToString(id[:])
+}
+
+// String renders id as hex.
+func (id SpanID) String() string {
+
+	return hex.EncodeToString(id[:])
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Name       string
+	Kind       Kind
+	Flags      byte
+	State      string
+	Start      time.Time
+	End        time.Time
+	Error      bool
+	Attributes map[string]any
+	tracer     *Tracer
+	mu         sync.Mutex
+	ended      bool
+}
+
+// SetAttribute sets an attribute on the span.
+func (span *Span) SetAttribute(key string, val any) {
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	span.Attributes[key] = val
+}
+
+// SetError marks the span as failed.
+func (span *Span) SetError() {
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	span.Error = true
+}
+
+// Finish ends the span and hands it to the tracer for export, once.
+func (span *Span) Finish(ctx context.Context) {
+
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.End = time.Now()
+	span.mu.Unlock()
+
+	if span.tracer != nil {
+		span.tracer.export(ctx, span)
+	}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (span *Span) Sampled() bool {
+
+	return span.Flags&sampledFlag != 0
+}
+
+// Traceparent renders the span as a traceparent header value.
+func (span *Span) Traceparent() string {
+
+	return fmt.Sprintf("00-%s-%s-%02x", span.TraceID, span.SpanID, span.Flags)
+}
+
+// FromContext gets the current span from ctx, nil when not found.
+func FromContext(ctx context.Context) *Span {
+
+	span, _ := ctx.Value(ctxKey{}).(*Span)
+	return span
+}
+
+// Inject sets traceparent and tracestate on header, as for an outgoing request, per the current span in ctx.
+func Inject(ctx context.Context, header http.Header) {
+
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	header.Set(traceparentHeader, span.Traceparent())
+	if span.State != "" {
+		header.Set(tracestateHeader, span.State)
+	}
+}
+
+// unexported
+
+type ctxKey struct{}
+
+type parent struct {
+	traceID TraceID
+	spanID  SpanID
+	flags   byte
+	state   string
+}
+
+// parseParent parses W3C trace context headers, ok false when traceparent is absent or invalid.
+func parseParent(header http.Header) (prt parent, ok bool) {
+
+	parts := strings.Split(strings.TrimSpace(header.Get(traceparentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return
+	}
+
+	if !decodeHex(prt.traceID[:], parts[1]) || !decodeHex(prt.spanID[:], parts[2]) {
+		return
+	}
+	if prt.traceID == (TraceID{}) || prt.spanID == (SpanID{}) {
+		return
+	}
+
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		return
+	}
+	prt.flags = flags[0]
+
+	state := strings.Join(header.Values(tracestateHeader), ",")
+	if len(state) <= maxTracestate {
+		prt.state = state
+	}
+
+	return prt, true
+}
+
+func decodeHex(dst []byte, src string) bool {
+
+	if len(src) != hex.EncodedLen(len(dst)) || strings.ToLower(src) != src {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+func newTraceID() (id TraceID) {
+
+	_, _ = rand.Read(id[:]) // never errors, per crypto/rand
+	return
+}
+
+func newSpanID() (id SpanID) {
+
+	_, _ = rand.Read(id[:]) // never errors, per crypto/rand
+	return
+}
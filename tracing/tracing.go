@@ -0,0 +1,280 @@
+// Package tracing provides W3C trace context propagation and server spans,
+// exported as OTLP/JSON or logged, without a full tracing sdk.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/clarktrimble/delish/logger"
+	"github.com/clarktrimble/delish/mid"
+)
+
+const (
+	defaultBatchSize int           = 100
+	defaultInterval  time.Duration = 5 * time.Second
+	defaultTimeout   time.Duration = 10 * time.Second
+	queueFactor      int           = 10
+)
+
+// Config is the tracer's configuration.
+type Config struct {
+	Endpoint    string        `json:"endpoint" desc:"otlp/json traces url such as http://localhost:4318/v1/traces, logged when blank"`
+	ServiceName string        `json:"service_name" desc:"service.name resource attribute" default:"delish"`
+	BatchSize   int           `json:"batch_size" desc:"most spans per export" default:"100"`
+	Interval    time.Duration `json:"interval" desc:"longest wait between exports" default:"5s"`
+	Timeout     time.Duration `json:"timeout" desc:"export request timeout" default:"10s"`
+}
+
+// Tracer creates spans and exports them when finished.
+//
+// With an Endpoint, finished spans are queued and exported in batches once started.
+// Spans are dropped, and counted, when the queue is full.
+// Without, each finished span is logged at trace level.
+type Tracer struct {
+	Endpoint    string
+	ServiceName string
+	BatchSize   int
+	Interval    time.Duration
+	Client      *http.Client
+	Logger      logger.Logger
+	queue       chan *Span
+	dropped     atomic.Int64
+}
+
+// New creates a Tracer from Config.
+func (cfg *Config) New(lgr logger.Logger) (tr *Tracer) {
+
+	tr = &Tracer{
+		Endpoint:    cfg.Endpoint,
+		ServiceName: cfg.ServiceName,
+		BatchSize:   cfg.BatchSize,
+		Interval:    cfg.Interval,
+		Client:      &http.Client{Timeout: cfg.Timeout},
+		Logger:      lgr,
+	}
+
+	if tr.BatchSize < 1 {
+		tr.BatchSize = defaultBatchSize
+	}
+	if tr.Interval <= 0 {
+		tr.Interval = defaultInterval
+	}
+	if tr.Client.Timeout <= 0 {
+		tr.Client.Timeout = defaultTimeout
+	}
+	tr.queue = make(chan *Span, tr.BatchSize*queueFactor)
+
+	return
+}
+
+// Start starts exporting in the background, flushing what is queued when ctx is cancelled.
+//
+// Nothing is started without an Endpoint.
+func (tr *Tracer) Start(ctx context.Context, wg *sync.WaitGroup) {
+
+	if tr.Endpoint == "" {
+		return
+	}
+
+	tr.Logger.Info(ctx, "starting trace exporter", "endpoint", tr.Endpoint)
+
+	wg.Add(1)
+	go tr.work(ctx, wg)
+}
+
+// Dropped gets the count of spans dropped for want of room in the queue.
+func (tr *Tracer) Dropped() int64 {
+
+	return tr.dropped.Load()
+}
+
+// StartSpan starts a span as child of the current span in ctx, if any, adding it to the returned ctx.
+//
+// Finish the span when done.
+func (tr *Tracer) StartSpan(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+
+	span := &Span{
+		SpanID:     newSpanID(),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]any{},
+		tracer:     tr,
+	}
+
+	current := FromContext(ctx)
+	if current != nil {
+		span.TraceID = current.TraceID
+		span.ParentID = current.SpanID
+		span.Flags = current.Flags
+		span.State = current.State
+	} else {
+		span.TraceID = newTraceID()
+		span.Flags = sampledFlag
+	}
+
+	return tr.withSpan(ctx, span), span
+}
+
+// Trace is a middleware creating a server span per request.
+//
+// The span continues a trace given by valid traceparent and tracestate headers,
+// or starts a new one, and is available to handlers via FromContext.
+// trace_id and span_id are added to the ctx logging fields.
+// Responses with a 5xx status mark the span as failed.
+func (tr *Tracer) Trace(next http.Handler) http.HandlerFunc {
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+
+		span := &Span{
+			SpanID:     newSpanID(),
+			Kind:       KindServer,
+			Start:      time.Now(),
+			Attributes: map[string]any{},
+			tracer:     tr,
+		}
+
+		prt, ok := parseParent(request.Header)
+		if ok {
+			span.TraceID = prt.traceID
+			span.ParentID = prt.spanID
+			span.Flags = prt.flags
+			span.State = prt.state
+		} else {
+			span.TraceID = newTraceID()
+			span.Flags = sampledFlag
+		}
+
+		ctx := tr.withSpan(mid.WithRoute(request.Context()), span)
+		request = request.WithContext(ctx)
+
+		str := mid.NewStreaming(writer)
+		next.ServeHTTP(str, request)
+
+		// pattern is known once routed, as by http.ServeMux, and held for us by request logging
+		pattern := mid.Route(request)
+
+		span.mu.Lock()
+		span.Name = request.Method
+		if pattern != "" {
+			span.Name = pattern
+		}
+		span.mu.Unlock()
+
+		if pattern != "" {
+			span.SetAttribute("http.route", pattern)
+		}
+		span.SetAttribute("http.request.method", request.Method)
+		span.SetAttribute("http.response.status_code", str.Status())
+		if request.URL != nil {
+			span.SetAttribute("url.path", request.URL.Path)
+		}
+		if str.Status() >= http.StatusInternalServerError {
+			span.SetError()
+		}
+
+		span.Finish(ctx)
+	}
+}
+
+// unexported
+
+func (tr *Tracer) withSpan(ctx context.Context, span *Span) context.Context {
+
+	ctx = context.WithValue(ctx, ctxKey{}, span)
+	return tr.Logger.WithFields(ctx, "trace_id", span.TraceID.String(), "span_id", span.SpanID.String())
+}
+
+func (tr *Tracer) export(ctx context.Context, span *Span) {
+
+	if !span.Sampled() {
+		return
+	}
+
+	if tr.Endpoint == "" {
+		tr.Logger.Trace(ctx, "span finished", span.fields()...)
+		return
+	}
+
+	select {
+	case tr.queue <- span:
+	default:
+		tr.dropped.Add(1)
+	}
+}
+
+func (tr *Tracer) work(ctx context.Context, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	ticker := time.NewTicker(tr.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, tr.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := tr.post(ctx, batch)
+		if err != nil {
+			tr.Logger.Error(ctx, "failed to export spans", err, "count", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-tr.queue:
+			batch = append(batch, span)
+			if len(batch) >= tr.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			tr.drain(&batch)
+			flush(context.WithoutCancel(ctx))
+			tr.Logger.Info(ctx, "trace exporter stopped", "dropped", tr.Dropped())
+			return
+		}
+	}
+}
+
+func (tr *Tracer) drain(batch *[]*Span) {
+
+	for {
+		select {
+		case span := <-tr.queue:
+			*batch = append(*batch, span)
+		default:
+			return
+		}
+	}
+}
+
+func (span *Span) fields() []any {
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	fields := []any{
+		"name", span.Name,
+		"kind", span.Kind,
+		"trace_id", span.TraceID.String(),
+		"span_id", span.SpanID.String(),
+		"elapsed", span.End.Sub(span.Start),
+		"error", span.Error,
+		"attributes", span.Attributes,
+	}
+
+	if span.ParentID != (SpanID{}) {
+		fields = append(fields, "parent_id", span.ParentID.String())
+	}
+
+	return fields
+}
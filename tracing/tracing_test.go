@@ -0,0 +1,324 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clarktrimble/delish/mid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate moq -pkg tracing -out mock_test.go ../logger Logger
+
+func TestTracing(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing Suite")
+}
+
+const (
+	incoming string = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		lgr *LoggerMock
+		tr  *Tracer
+	)
+
+	BeforeEach(func() {
+		lgr = &LoggerMock{
+			InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+			TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+			ErrorFunc: func(ctx context.Context, msg string, err error, kv ...any) {},
+			WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+				return ctx
+			},
+		}
+
+		tr = (&Config{ServiceName: "test"}).New(lgr)
+	})
+
+	DescribeTable("parsing trace context",
+		func(traceparent, tracestate string, ok bool, expected string) {
+			header := http.Header{}
+			header.Set("traceparent", traceparent)
+			if tracestate != "" {
+				header.Set("tracestate", tracestate)
+			}
+
+			prt, gotOk := parseParent(header)
+			Expect(gotOk).To(Equal(ok))
+			if ok {
+				span := &Span{TraceID: prt.traceID, SpanID: prt.spanID, Flags: prt.flags}
+				Expect(span.Traceparent()).To(Equal(expected))
+				Expect(prt.state).To(Equal(tracestate))
+			}
+		},
+		Entry("valid", incoming, "", true, incoming),
+		Entry("valid with state", incoming, "congo=t61rcWkgMzE", true, incoming),
+		Entry("unsampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", "", true,
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"),
+		Entry("future version with more parts", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-what", "", true, incoming),
+		Entry("blank", "", "", false, ""),
+		Entry("uppercase", "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", "", false, ""),
+		Entry("zero trace id", "00-00000000000000000000000000000000-b7ad6b7169203331-01", "", false, ""),
+		Entry("zero span id", "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", "", false, ""),
+		Entry("invalid version", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "", false, ""),
+		Entry("version 00 with more parts", incoming+"-what", "", false, ""),
+		Entry("short span id", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01", "", false, ""),
+	)
+
+	Describe("tracing a request", func() {
+		var (
+			request  *http.Request
+			recorder *httptest.ResponseRecorder
+			status   int
+			inner    *Span
+			outgoing http.Header
+		)
+
+		BeforeEach(func() {
+			request = httptest.NewRequest("GET", "/items/42", nil)
+			recorder = httptest.NewRecorder()
+			status = 200
+		})
+
+		JustBeforeEach(func() {
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {
+				inner = FromContext(request.Context())
+				outgoing = http.Header{}
+				Inject(request.Context(), outgoing)
+				writer.WriteHeader(status)
+			})
+
+			tr.Trace(rtr).ServeHTTP(recorder, request)
+		})
+
+		When("no trace context is given", func() {
+			It("starts a trace, adds log fields, and logs the finished span", func() {
+				Expect(inner).ToNot(BeNil())
+				Expect(inner.TraceID).ToNot(Equal(TraceID{}))
+				Expect(inner.ParentID).To(Equal(SpanID{}))
+				Expect(outgoing.Get("traceparent")).To(Equal(inner.Traceparent()))
+
+				wfc := lgr.WithFieldsCalls()
+				Expect(wfc).To(HaveLen(1))
+				Expect(wfc[0].Kv).To(HaveExactElements([]any{
+					"trace_id", inner.TraceID.String(),
+					"span_id", inner.SpanID.String(),
+				}))
+
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Msg).To(Equal("span finished"))
+				Expect(tc[0].Kv).To(ContainElements(
+					"name", "GET /items/{id}",
+					"kind", KindServer,
+					"error", false,
+					"attributes", map[string]any{
+						"http.route":                "GET /items/{id}",
+						"http.request.method":       "GET",
+						"http.response.status_code": 200,
+						"url.path":                  "/items/42",
+					},
+				))
+			})
+		})
+
+		When("trace context is given", func() {
+			BeforeEach(func() {
+				request.Header.Set("traceparent", incoming)
+				request.Header.Set("tracestate", "congo=t61rcWkgMzE")
+			})
+
+			It("continues the trace and propagates state", func() {
+				Expect(inner.TraceID.String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+				Expect(inner.ParentID.String()).To(Equal("b7ad6b7169203331"))
+				Expect(inner.SpanID.String()).ToNot(Equal("b7ad6b7169203331"))
+
+				Expect(outgoing.Get("traceparent")).To(HavePrefix("00-0af7651916cd43dd8448eb211c80319c-"))
+				Expect(outgoing.Get("tracestate")).To(Equal("congo=t61rcWkgMzE"))
+
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Kv).To(ContainElements("parent_id", "b7ad6b7169203331"))
+			})
+		})
+
+		When("the caller is not sampling", func() {
+			BeforeEach(func() {
+				request.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+			})
+
+			It("propagates but does not export", func() {
+				Expect(outgoing.Get("traceparent")).To(HaveSuffix("-00"))
+				Expect(lgr.TraceCalls()).To(BeEmpty())
+			})
+		})
+
+		When("the handler fails", func() {
+			BeforeEach(func() {
+				status = 503
+			})
+
+			It("marks the span as failed", func() {
+				tc := lgr.TraceCalls()
+				Expect(tc).To(HaveLen(1))
+				Expect(tc[0].Kv).To(ContainElements("error", true))
+				Expect(recorder.Code).To(Equal(503))
+			})
+		})
+	})
+
+	Describe("tracing beyond request logging", func() {
+		It("names the span by the pattern held by logging", func() {
+			rtr := http.NewServeMux()
+			rtr.HandleFunc("GET /items/{id}", func(writer http.ResponseWriter, request *http.Request) {})
+
+			lg := mid.NewLogging(&LoggerMock{
+				InfoFunc:  func(ctx context.Context, msg string, kv ...any) {},
+				TraceFunc: func(ctx context.Context, msg string, kv ...any) {},
+				WithFieldsFunc: func(ctx context.Context, kv ...any) context.Context {
+					return ctx
+				},
+			})
+
+			request := httptest.NewRequest("GET", "/items/42", nil)
+			tr.Trace(lg.Wrap(rtr)).ServeHTTP(httptest.NewRecorder(), request)
+
+			tc := lgr.TraceCalls()
+			Expect(tc).To(HaveLen(1))
+			Expect(tc[0].Kv).To(ContainElements(
+				"name", "GET /items/{id}",
+				"attributes", map[string]any{
+					"http.route":                "GET /items/{id}",
+					"http.request.method":       "GET",
+					"http.response.status_code": 200,
+					"url.path":                  "/items/42",
+				},
+			))
+		})
+	})
+
+	Describe("passing through optional interfaces", func() {
+
+		It("leaves the writer hijackable and a reader from", func() {
+			var hijacker, readerFrom bool
+
+			handler := tr.Trace(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				_, hijacker = writer.(http.Hijacker)
+				_, readerFrom = writer.(io.ReaderFrom)
+				writer.WriteHeader(http.StatusSwitchingProtocols)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ws", nil))
+
+			Expect(hijacker).To(BeTrue())
+			Expect(readerFrom).To(BeTrue())
+			Expect(lgr.TraceCalls()).To(HaveLen(1))
+		})
+	})
+
+	Describe("starting a child span", func() {
+		var (
+			parent *Span
+			child  *Span
+		)
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, parent = tr.StartSpan(context.Background(), "parent", KindInternal)
+			_, child = tr.StartSpan(ctx, "child", KindClient)
+
+			child.SetAttribute("ima", "pc")
+			child.Finish(ctx)
+			child.Finish(ctx)
+		})
+
+		It("is in the same trace, under the parent, and finishes once", func() {
+			Expect(child.TraceID).To(Equal(parent.TraceID))
+			Expect(child.ParentID).To(Equal(parent.SpanID))
+			Expect(lgr.TraceCalls()).To(HaveLen(1))
+		})
+	})
+
+	Describe("exporting to a collector", func() {
+		var (
+			received []otlpRequest
+			mu       sync.Mutex
+		)
+
+		BeforeEach(func() {
+			received = nil
+
+			collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				defer GinkgoRecover()
+
+				Expect(request.Method).To(Equal("POST"))
+				Expect(request.Header.Get("Content-Type")).To(Equal("application/json"))
+
+				data, err := io.ReadAll(request.Body)
+				Expect(err).ToNot(HaveOccurred())
+
+				var otlp otlpRequest
+				Expect(json.Unmarshal(data, &otlp)).To(Succeed())
+
+				mu.Lock()
+				received = append(received, otlp)
+				mu.Unlock()
+			}))
+			DeferCleanup(collector.Close)
+
+			tr = (&Config{
+				Endpoint:    collector.URL,
+				ServiceName: "test",
+				Interval:    time.Hour,
+			}).New(lgr)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+			tr.Start(ctx, &wg)
+
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("traceparent", incoming)
+			tr.Trace(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), request)
+
+			cancel()
+			wg.Wait()
+		})
+
+		It("posts otlp/json on shutdown", func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			Expect(received).To(HaveLen(1))
+			rs := received[0].ResourceSpans
+			Expect(rs).To(HaveLen(1))
+			Expect(*rs[0].Resource.Attributes[0].Value.StringValue).To(Equal("test"))
+
+			spans := rs[0].ScopeSpans[0].Spans
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].TraceID).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+			Expect(spans[0].ParentSpanID).To(Equal("b7ad6b7169203331"))
+			Expect(spans[0].Name).To(Equal("GET"))
+			Expect(spans[0].Kind).To(Equal(KindServer))
+			Expect(spans[0].Status.Code).To(Equal(statusOk))
+			start, err := strconv.ParseInt(spans[0].StartTimeUnixNano, 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			end, err := strconv.ParseInt(spans[0].EndTimeUnixNano, 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(end).To(BeNumerically(">=", start))
+
+			Expect(lgr.TraceCalls()).To(BeEmpty())
+			Expect(lgr.ErrorCalls()).To(BeEmpty())
+		})
+	})
+})